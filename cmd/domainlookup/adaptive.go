@@ -0,0 +1,110 @@
+package main
+
+import "sync"
+
+const (
+	defaultAdaptiveMin    = 1
+	defaultAdaptiveMax    = 1024
+	defaultAdaptiveTarget = 0.02
+
+	// results per rolling window the error rate is evaluated over
+	adaptiveWindow = 100
+)
+
+// adaptiveLimiter bounds concurrent lookups to a limit that shrinks while
+// the rolling error rate is over target and grows while it is well under
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	inFlight int
+
+	min, max int
+	target   float64
+
+	// current window
+	seen, errors int
+}
+
+func newAdaptiveLimiter(start, min, max int, target float64) *adaptiveLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if start < min {
+		start = min
+	}
+	if start > max {
+		start = max
+	}
+	limiter := &adaptiveLimiter{limit: start, min: min, max: max, target: target}
+	limiter.cond = sync.NewCond(&limiter.mu)
+	return limiter
+}
+
+// Acquire blocks until a lookup may start
+func (l *adaptiveLimiter) Acquire() {
+	l.mu.Lock()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	l.mu.Unlock()
+}
+
+// Release ends a lookup started with Acquire, observing its result
+func (l *adaptiveLimiter) Release(result *DomainLookupResult) {
+	l.mu.Lock()
+	l.inFlight--
+	l.seen++
+	if isOverloaded(result) {
+		l.errors++
+	}
+	if l.seen >= adaptiveWindow {
+		l.adjust(float64(l.errors) / float64(l.seen))
+		l.seen, l.errors = 0, 0
+	}
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// adjust shrinks the limit by a quarter over target and grows it by a tenth
+// under half of target
+func (l *adaptiveLimiter) adjust(errorRate float64) {
+	limit := l.limit
+	switch {
+	case errorRate > l.target:
+		limit -= limit/4 + 1
+	case errorRate < l.target/2:
+		limit += limit/10 + 1
+	}
+	if limit < l.min {
+		limit = l.min
+	}
+	if limit > l.max {
+		limit = l.max
+	}
+	if limit != l.limit {
+		verboseLog.Printf("adaptive concurrency %d -> %d at error rate %.1f%%", l.limit, limit, errorRate*100)
+		l.limit = limit
+	}
+}
+
+// Limit returns the current concurrency limit
+func (l *adaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// isOverloaded reports whether result suggests the server is overloaded
+func isOverloaded(result *DomainLookupResult) bool {
+	switch result.Message {
+	case messageRateLimited, messageTimeout, messageServerError, messageConnectionReset, messageTLSTimeout:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "golang.org/x/net/publicsuffix"
+
+// apexDomain returns the registrable domain, eTLD+1 by the public suffix
+// list, of the host. ok is false when host is a public suffix itself
+func apexDomain(host string) (apex string, ok bool) {
+	apex, err := publicsuffix.EffectiveTLDPlusOne(lookupName(host))
+	if err != nil {
+		return "", false
+	}
+	return apex, true
+}
+
+// apexReducer reduces input hosts to their apex, dropping apexes seen before
+type apexReducer struct {
+	seen map[string]bool
+
+	// duplicate apexes dropped
+	collapsed int
+}
+
+func newApexReducer() *apexReducer {
+	return &apexReducer{seen: make(map[string]bool)}
+}
+
+// Reduce replaces the domain of input with its apex, keeping the original.
+// keep is false for a duplicate apex, public suffixes are kept as they are
+func (reducer *apexReducer) Reduce(input *lookupInput) (keep bool) {
+	apex, ok := apexDomain(input.domain)
+	if !ok {
+		return true
+	}
+	if reducer.seen[apex] {
+		reducer.collapsed++
+		return false
+	}
+	reducer.seen[apex] = true
+	input.original = input.domain
+	input.domain = apex
+	return true
+}
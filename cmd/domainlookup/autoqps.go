@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaults of -auto-qps-min and -auto-qps-max
+const (
+	defaultAutoQPSMin = 0.1
+	defaultAutoQPSMax = 50
+)
+
+// serverPacer paces the requests of each server at the rate its rate limit
+// headers advertise with -auto-qps, clamped to min and max QPS. Servers
+// without a hint aren't paced beyond -global-qps
+type serverPacer struct {
+	min, max float64
+	now      clock
+
+	mu       sync.Mutex
+	limiters map[string]*tokenBucket
+}
+
+func newServerPacer(min, max float64, now clock) *serverPacer {
+	return &serverPacer{min: min, max: max, now: now, limiters: make(map[string]*tokenBucket)}
+}
+
+// advertisedWindow returns the window of the limit header advertises: the w
+// parameter of the draft's RateLimit-Policy, or else the reset of the first
+// request of a window, the only one whose reset is the whole window
+func advertisedWindow(header http.Header, limit int) time.Duration {
+	policy, _, _ := strings.Cut(header.Get("RateLimit-Policy"), ",")
+	for _, param := range strings.Split(policy, ";")[1:] {
+		if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "w" {
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	remaining, ok := headerInt(header, rateRemainingHeaders)
+	if !ok || remaining != limit-1 {
+		return 0
+	}
+	// a Unix time isn't a window
+	if reset, ok := headerInt(header, rateResetHeaders); ok && reset > 0 && reset <= 1e9 {
+		return time.Duration(reset) * time.Second
+	}
+	return 0
+}
+
+// Observe paces host by the first limit and window its responses advertise
+func (pacer *serverPacer) Observe(host string, header http.Header) {
+	if pacer == nil {
+		return
+	}
+	pacer.mu.Lock()
+	_, known := pacer.limiters[host]
+	pacer.mu.Unlock()
+	if known {
+		return
+	}
+	limit, ok := headerInt(header, rateLimitHeaders)
+	if !ok || limit == 0 {
+		return
+	}
+	window := advertisedWindow(header, limit)
+	if window == 0 {
+		return
+	}
+	qps := float64(limit) / window.Seconds()
+	if qps < pacer.min {
+		qps = pacer.min
+	}
+	if qps > pacer.max {
+		qps = pacer.max
+	}
+
+	pacer.mu.Lock()
+	defer pacer.mu.Unlock()
+	if _, known := pacer.limiters[host]; known {
+		return
+	}
+	pacer.limiters[host] = newTokenBucket(qps, 1, pacer.now)
+	verboseLog.Printf("%s advertises %d requests per %v, pacing it at %.2f QPS", host, limit, window, qps)
+}
+
+// Wait blocks until a request to host is due or ctx is done
+func (pacer *serverPacer) Wait(ctx context.Context, host string) error {
+	if pacer == nil {
+		return nil
+	}
+	pacer.mu.Lock()
+	limiter := pacer.limiters[host]
+	pacer.mu.Unlock()
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// basicAuthEnv holds -basic-auth credentials kept out of the process args
+const basicAuthEnv = "DOMAINLOOKUP_BASIC_AUTH"
+
+// basicAuth are credentials sent to the hosts of -override servers only, so
+// public RDAP servers of the bootstrap never see them
+type basicAuth struct {
+	user, password string
+	hosts          map[string]bool
+}
+
+// loadBasicAuth reads user:password credentials from value, else from file,
+// else from $DOMAINLOOKUP_BASIC_AUTH, nil when none is set
+func loadBasicAuth(value, file string, overrides map[string][]string) (*basicAuth, error) {
+	credentials := value
+	if credentials == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		credentials = strings.TrimSpace(string(data))
+	}
+	if credentials == "" {
+		credentials = os.Getenv(basicAuthEnv)
+	}
+	if credentials == "" {
+		return nil, nil
+	}
+
+	user, password, ok := strings.Cut(credentials, ":")
+	if !ok || user == "" {
+		return nil, errors.New("basic auth credentials are not user:password")
+	}
+	auth := &basicAuth{user: user, password: password, hosts: make(map[string]bool)}
+	for _, servers := range overrides {
+		for _, server := range servers {
+			// the host queried, the server normalized like rdapObjectURL does
+			u, err := url.Parse(withScheme(server))
+			if err != nil {
+				return nil, fmt.Errorf("invalid rdap url %q: %w", redact(server), err)
+			}
+			if u.Host == "" {
+				return nil, fmt.Errorf("rdap url %q has no host to send basic auth to", redact(server))
+			}
+			auth.hosts[u.Host] = true
+		}
+	}
+	if len(auth.hosts) == 0 {
+		return nil, errors.New("basic auth is only sent to -override servers, none given")
+	}
+	return auth, nil
+}
+
+// apply sets the credentials on req when it goes to an -override host
+func (auth *basicAuth) apply(req *http.Request) {
+	if auth != nil && auth.hosts[req.URL.Host] {
+		req.SetBasicAuth(auth.user, auth.password)
+	}
+}
+
+// redact masks the password of a URL with userinfo for logs and output
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
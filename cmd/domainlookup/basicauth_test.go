@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadBasicAuthHosts(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string][]string
+		want      map[string]bool
+		wantErr   string
+	}{
+		{"with scheme", map[string][]string{"com": {"https://rdap.example/v1/"}}, map[string]bool{"rdap.example": true}, ""},
+		{"no scheme", map[string][]string{"com": {"rdap.example/v1/"}}, map[string]bool{"rdap.example": true}, ""},
+		{"spaces and port", map[string][]string{"com": {" rdap.example:8443 "}}, map[string]bool{"rdap.example:8443": true}, ""},
+		{"template", map[string][]string{"com": {"rdap.example/lookup?name={domain}"}}, map[string]bool{"rdap.example": true}, ""},
+		{"several", map[string][]string{"com": {"a.example", "http://b.example/"}, "net": {"a.example"}}, map[string]bool{"a.example": true, "b.example": true}, ""},
+		{"empty host", map[string][]string{"com": {"https:///v1"}}, nil, "has no host"},
+		{"none", map[string][]string{}, nil, "none given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := loadBasicAuth("user:secret", "", tt.overrides)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(auth.hosts, tt.want) {
+				t.Errorf("hosts = %v, want %v", auth.hosts, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicAuthSentToOverrides(t *testing.T) {
+	var got string
+	worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	_, other := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	auth, err := loadBasicAuth("user:secret", "", map[string][]string{"com": {server + "/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.auth = auth
+
+	worker.lookupServer(context.Background(), "example.com", "com", server)
+	if want := "Basic dXNlcjpzZWNyZXQ="; got != want {
+		t.Errorf("override got Authorization %q, want %q", got, want)
+	}
+	got = ""
+	worker.lookupServer(context.Background(), "example.net", "net", other)
+	if got != "" {
+		t.Errorf("other server got Authorization %q", got)
+	}
+}
+
+func TestLookupServerRefused(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials bool
+		status      int
+		want        string
+		wantExplain string
+	}{
+		{"401 without credentials", false, http.StatusUnauthorized, messageUnauthorized, "401 means the server wants credentials"},
+		{"401 with credentials", true, http.StatusUnauthorized, messageUnauthorized, "401 means the server wants credentials"},
+		{"403 without credentials", false, http.StatusForbidden, messageForbidden, "403 means the server refused the query or this IP"},
+		{"403 with credentials", true, http.StatusForbidden, messageForbidden, "403 means the server refused the query or this IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, serveRdap(tt.status, "application/rdap+json", ""))
+			if tt.credentials {
+				auth, err := loadBasicAuth("user:secret", "", map[string][]string{"com": {server}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				worker.auth = auth
+			}
+			worker.explain = true
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+			if !strings.Contains(result.Explanation, tt.wantExplain) {
+				t.Errorf("explanation %q, want %q", result.Explanation, tt.wantExplain)
+			}
+		})
+	}
+}
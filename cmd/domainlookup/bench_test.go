@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Benchmarks of the lookup path, see the tuning section of the README. Run
+// them with
+//
+//	go test -run '^$' -bench . ./cmd/domainlookup
+
+func BenchmarkLookupMap(b *testing.B) {
+	dns, err := decodeRdapDNS(bytes.NewReader(embeddedRdapDNS))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := dns.LookupMap(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// cannedTransport answers every request in memory with status and body
+type cannedTransport struct {
+	status int
+	body   []byte
+}
+
+func (transport cannedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:        http.StatusText(transport.status),
+		StatusCode:    transport.status,
+		Header:        http.Header{"Content-Type": {"application/rdap+json"}},
+		Body:          io.NopCloser(bytes.NewReader(transport.body)),
+		ContentLength: int64(len(transport.body)),
+		Request:       req,
+	}, nil
+}
+
+// benchDomainJSON is a domain object like registries answer
+var benchDomainJSON = []byte(`{"objectClassName":"domain","ldhName":"EXAMPLE.COM","status":["client transfer prohibited"],` +
+	`"events":[{"eventAction":"registration","eventDate":"1995-08-14T04:00:00Z"},{"eventAction":"expiration","eventDate":"2025-08-13T04:00:00Z"}],` +
+	`"entities":[{"objectClassName":"entity","roles":["registrar"],"publicIds":[{"type":"IANA Registrar ID","identifier":"376"}],` +
+	`"vcardArray":["vcard",[["version",{},"text","4.0"],["fn",{},"text","RESERVED-Internet Assigned Numbers Authority"]]]}],` +
+	`"nameservers":[{"objectClassName":"nameserver","ldhName":"A.IANA-SERVERS.NET"},{"objectClassName":"nameserver","ldhName":"B.IANA-SERVERS.NET"}]}`)
+
+// BenchmarkClassify classifies responses without the network, the cost of
+// decoding and the status switch of lookupServer
+func BenchmarkClassify(b *testing.B) {
+	tests := []struct {
+		name   string
+		status int
+		body   []byte
+	}{
+		{"registered", http.StatusOK, benchDomainJSON},
+		{"unregistered", http.StatusNotFound, []byte(`{"errorCode":404,"title":"Not Found"}`)},
+		{"rate limited", http.StatusTooManyRequests, nil},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			worker := &LookupWorker{client: &http.Client{Transport: cannedTransport{tt.status, tt.body}}}
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				worker.lookupServer(ctx, "example.com", "com", "https://rdap.example/")
+			}
+		})
+	}
+}
+
+// BenchmarkEndToEnd looks up 200 domains through the worker pool against an
+// httptest server answering after 2ms, far quicker than real RDAP servers,
+// at several -c
+func BenchmarkEndToEnd(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Millisecond)
+		if strings.Contains(r.URL.Path, "free") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rdap+json")
+		w.Write(benchDomainJSON)
+	}))
+	defer srv.Close()
+	const domains = 200
+
+	for _, concurrency := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("c-%d", concurrency), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				unchecked := make(chan lookupInput, concurrency)
+				worker := &LookupWorker{
+					unchecked:     unchecked,
+					client:        srv.Client(),
+					rdapLookupMap: map[string][]string{"com": {srv.URL}},
+					concurrencies: make(chan struct{}, concurrency),
+					Result:        make(chan *DomainLookupResult, concurrency),
+				}
+				go func() {
+					for n := 0; n < domains; n++ {
+						name := fmt.Sprintf("domain-%d.com", n)
+						if n%2 == 0 {
+							name = fmt.Sprintf("free-%d.com", n)
+						}
+						unchecked <- lookupInput{domain: name}
+					}
+					close(unchecked)
+				}()
+				go worker.Start()
+				results := 0
+				for range worker.Result {
+					results++
+				}
+				if results != domains {
+					b.Fatalf("got %d results, want %d", results, domains)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// -block-action actions
+const (
+	blockPause = "pause"
+	blockAbort = "abort"
+)
+
+const defaultBlockPause = 5 * time.Minute
+
+// blockWatch detects the egress IP being blocked: threshold consecutive
+// lookups answered 403 or 429, whatever their TLD. It then pauses the
+// dispatch of lookups or stops it for an abort
+type blockWatch struct {
+	threshold int
+	abort     bool
+	pause     time.Duration
+
+	mu          sync.Mutex
+	consecutive int
+	servers     map[string]bool
+	tripped     bool
+}
+
+func newBlockWatch(threshold int, action string, pause time.Duration) (*blockWatch, error) {
+	if action != blockPause && action != blockAbort {
+		return nil, fmt.Errorf("unknown -block-action %q, want pause or abort", action)
+	}
+	return &blockWatch{threshold: threshold, abort: action == blockAbort, pause: pause, servers: make(map[string]bool)}, nil
+}
+
+// isBlocked reports whether result is a refusal a blocked IP gets, 429 or
+// 403. A 401 asks for credentials, it isn't counted
+func isBlocked(result *DomainLookupResult) bool {
+	return !result.Cached && (result.statusCode == http.StatusTooManyRequests || result.statusCode == http.StatusForbidden)
+}
+
+// Record counts result towards the threshold, any other answer resets it
+func (watch *blockWatch) Record(result *DomainLookupResult) {
+	if watch == nil {
+		return
+	}
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	if watch.tripped {
+		// keep the counts that tripped it
+		return
+	}
+	if !isBlocked(result) {
+		if !result.Failed() {
+			watch.consecutive = 0
+			watch.servers = make(map[string]bool)
+		}
+		return
+	}
+	watch.consecutive++
+	if result.Result != nil {
+		watch.servers[result.Result.Server] = true
+	}
+	if watch.consecutive >= watch.threshold {
+		watch.tripped = true
+	}
+}
+
+// Check pauses while the threshold is reached, returning false when the
+// run should stop instead
+func (watch *blockWatch) Check() bool {
+	if watch == nil {
+		return true
+	}
+	watch.mu.Lock()
+	tripped, consecutive, servers := watch.tripped, watch.consecutive, len(watch.servers)
+	watch.mu.Unlock()
+	if !tripped {
+		return true
+	}
+	if watch.abort {
+		return false
+	}
+	warnLog.Printf("WARNING: %d lookups in a row got 403 or 429 (%d servers), the IP may be blocked, pausing %v",
+		consecutive, servers, watch.pause)
+	time.Sleep(watch.pause)
+	watch.mu.Lock()
+	watch.tripped, watch.consecutive = false, 0
+	watch.servers = make(map[string]bool)
+	watch.mu.Unlock()
+	return true
+}
+
+// Err describes the block that stopped the run, nil when it didn't
+func (watch *blockWatch) Err() error {
+	if watch == nil || !watch.abort {
+		return nil
+	}
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	if !watch.tripped {
+		return nil
+	}
+	return fmt.Errorf("%d lookups in a row got 403 or 429 (%d servers), the IP is likely blocked, stopped with the remaining input unchecked",
+		watch.consecutive, len(watch.servers))
+}
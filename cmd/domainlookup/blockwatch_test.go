@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestBlockWatchSignals(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantTripped bool
+	}{
+		{"429", http.StatusTooManyRequests, "", true},
+		{"403", http.StatusForbidden, "", true},
+		{"429 error object", http.StatusOK, `{"errorCode":429,"title":"Too Many Requests"}`, true},
+		{"401", http.StatusUnauthorized, "", false},
+		{"500", http.StatusInternalServerError, "", false},
+		{"404", http.StatusNotFound, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, serveRdap(tt.status, "application/rdap+json", tt.body))
+			watch, err := newBlockWatch(3, blockAbort, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				watch.Record(worker.lookupServer(context.Background(), "example.com", "com", server))
+			}
+			if watch.tripped != tt.wantTripped {
+				t.Errorf("tripped = %v, want %v", watch.tripped, tt.wantTripped)
+			}
+			if cached := (&DomainLookupResult{Cached: true, statusCode: tt.status}); isBlocked(cached) {
+				t.Error("a cached result counted as blocked")
+			}
+		})
+	}
+}
+
+func TestBlockWatchReset(t *testing.T) {
+	watch, err := newBlockWatch(2, blockAbort, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch.Record(&DomainLookupResult{Message: messageRateLimited, statusCode: http.StatusTooManyRequests})
+	watch.Record(&DomainLookupResult{Message: messageRegistered, statusCode: http.StatusOK})
+	watch.Record(&DomainLookupResult{Message: messageRateLimited, statusCode: http.StatusTooManyRequests})
+	if watch.tripped {
+		t.Error("tripped though a lookup succeeded in between")
+	}
+	// failures that aren't blocks neither count nor reset
+	watch.Record(&DomainLookupResult{Message: messageTimeout})
+	watch.Record(&DomainLookupResult{Message: messageUnauthorized, statusCode: http.StatusUnauthorized})
+	watch.Record(&DomainLookupResult{Message: messageRateLimited, statusCode: http.StatusTooManyRequests})
+	if !watch.tripped {
+		t.Error("not tripped by 2 blocks since the last success")
+	}
+	if watch.Check() {
+		t.Error("Check wants the run to go on after an abort trips")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBody is the largest read buffer kept for reuse, buffers grown by
+// rare huge responses are left to the GC rather than held
+const maxPooledBody = 256 << 10
+
+// bodyBuffers are reused to read response bodies. Reading into a fresh
+// slice grows it several times for a typical RDAP response, with a pooled
+// buffer only the exact size copy handed to the caller is allocated, see
+// BenchmarkReadBody. Results aren't pooled, -sort-by, -webhook batches, the
+// result cache and duplicates sharing a result hold them past the write
+var bodyBuffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// readBody reads r to the end like io.ReadAll into a pooled buffer, up to
+// limit bytes
+func readBody(r io.Reader, limit int64) ([]byte, error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	_, err := buf.ReadFrom(io.LimitReader(r, limit))
+	body := append([]byte(nil), buf.Bytes()...)
+	if buf.Cap() <= maxPooledBody {
+		bodyBuffers.Put(buf)
+	}
+	return body, err
+}
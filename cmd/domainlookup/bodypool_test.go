@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		limit int64
+		want  int
+	}{
+		{"empty", 0, 10, 0},
+		{"under the limit", 5, 10, 5},
+		{"over the limit", 20, 10, 10},
+		{"not pooled", 2 * maxPooledBody, 4 * maxPooledBody, 2 * maxPooledBody},
+	}
+	for _, tt := range tests {
+		body := strings.Repeat("x", tt.size)
+		got, err := readBody(strings.NewReader(body), tt.limit)
+		if err != nil || string(got) != body[:tt.want] {
+			t.Errorf("%s: read %d bytes, %v, want %d", tt.name, len(got), err, tt.want)
+		}
+	}
+	// a pooled buffer reused by the next read mustn't change a returned body
+	first, _ := readBody(strings.NewReader("first"), 10)
+	readBody(strings.NewReader("second"), 10)
+	if string(first) != "first" {
+		t.Errorf("first body became %q", first)
+	}
+}
+
+// BenchmarkReadBody compares reading response bodies into pooled buffers
+// with io.ReadAll, for a small error object, a typical domain object and a
+// large thick response
+func BenchmarkReadBody(b *testing.B) {
+	for _, size := range []int{200, 10 << 10, 100 << 10} {
+		body := bytes.Repeat([]byte("x"), size)
+		b.Run(fmt.Sprintf("pooled/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				readBody(bytes.NewReader(body), defaultMaxBody+1)
+			}
+		})
+		b.Run(fmt.Sprintf("readall/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				io.ReadAll(io.LimitReader(bytes.NewReader(body), defaultMaxBody+1))
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// embeddedRdapDNS is a partial bootstrap of common TLDs shipped with the
+// binary, not a copy of rdapDNSURL. It is only a last resort when the
+// bootstrap can't be fetched, other TLDs have no server with it. Replace it
+// with the full bootstrap with
+//
+//	curl -o cmd/domainlookup/dns.json https://data.iana.org/rdap/dns.json
+//
+//go:embed dns.json
+var embeddedRdapDNS []byte
+
+// bootstrap sources
+const (
+	bootstrapCache    = "cache"
+	bootstrapNetwork  = "network"
+	bootstrapEmbedded = "embedded"
+
+	defaultBootstrapOrder = bootstrapCache + "," + bootstrapNetwork + "," + bootstrapEmbedded
+	defaultBootstrapTTL   = 24 * time.Hour
+)
+
+// defaultBootstrapCache is where the fetched bootstrap is cached, "" when
+// the user has no cache directory
+func defaultBootstrapCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "domainlookup", "dns.json")
+}
+
+// bootstrapLoader loads the RDAP bootstrap from the first source of order
+// that works
+type bootstrapLoader struct {
+	// comma separated sources to try in turn
+	order string
+
+	dnsURL string
+
+	// snapshot of the embedded source, nil when there is none
+	embedded []byte
+
+	// cache file, "" disables the cache
+	cachePath string
+
+	// cached copies older than this are skipped
+	cacheTTL time.Duration
+
+	now clock
+}
+
+// Load returns the bootstrap and the source it came from. It only fails when
+// every source does
+func (loader *bootstrapLoader) Load() (dns *RdapDNS, source string, err error) {
+	var errs []string
+	for _, source := range strings.Split(loader.order, ",") {
+		source = strings.TrimSpace(source)
+		dns, err := loader.load(source)
+		if err == nil && len(dns.Services) == 0 {
+			err = errors.New("rdap services is empty")
+		}
+		if err != nil {
+			verboseLog.Printf("rdap bootstrap from %s: %v", source, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+
+		if dns.Publication != "" {
+			verboseLog.Printf("rdap bootstrap from %s published %s", source, dns.Publication)
+		} else {
+			verboseLog.Printf("rdap bootstrap from %s", source)
+		}
+		if source == bootstrapEmbedded {
+			warnLog.Printf("WARNING: failed to load RDAP bootstrap: %s", strings.Join(errs, "; "))
+			warnLog.Printf("WARNING: using the embedded RDAP bootstrap, it is PARTIAL with %d TLDs, others have no RDAP server with it", dns.tldCount())
+		}
+		return dns, source, nil
+	}
+	return nil, "", fmt.Errorf("no rdap bootstrap source worked: %s", strings.Join(errs, "; "))
+}
+
+func (loader *bootstrapLoader) load(source string) (*RdapDNS, error) {
+	switch source {
+	case bootstrapCache:
+		return loader.loadCache()
+	case bootstrapNetwork:
+		dns, err := rdapDNSInfo(loader.dnsURL)
+		if err == nil {
+			if err := loader.saveCache(dns); err != nil {
+				warnLog.Printf("cache rdap bootstrap: %v", err)
+			}
+		}
+		return dns, err
+	case bootstrapEmbedded:
+		if loader.embedded == nil {
+			return nil, errors.New("no embedded snapshot")
+		}
+		return decodeRdapDNS(bytes.NewReader(loader.embedded))
+	default:
+		return nil, fmt.Errorf("unknown bootstrap source %q", source)
+	}
+}
+
+// loadCache reads the cached bootstrap when it is fresh
+func (loader *bootstrapLoader) loadCache() (*RdapDNS, error) {
+	if loader.cachePath == "" {
+		return nil, errors.New("no cache file")
+	}
+	file, err := os.Open(loader.cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if age := loader.now.Since(info.ModTime()); loader.cacheTTL > 0 && age > loader.cacheTTL {
+		return nil, fmt.Errorf("%s is stale, cached %v ago", loader.cachePath, age.Round(time.Second))
+	}
+	return decodeRdapDNS(file)
+}
+
+// saveCache atomically replaces the cached bootstrap with dns
+func (loader *bootstrapLoader) saveCache(dns *RdapDNS) error {
+	if loader.cachePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(dns)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(loader.cachePath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".dns.json.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), loader.cachePath)
+}
+
+// tldCount is the number of TLDs the bootstrap lists servers for
+func (dns *RdapDNS) tldCount() int {
+	n := 0
+	for _, service := range dns.Services {
+		if len(service) > 0 {
+			n += len(service[0])
+		}
+	}
+	return n
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// catchAllLabel returns a random name no registry has, looked up under each
+// TLD by -catch-all-check
+func catchAllLabel() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "domainlookup-check-" + hex.EncodeToString(b)
+}
+
+// checkCatchAll looks up a random name under each of tlds with its first
+// RDAP server and returns the TLDs whose server answered it isn't free, the
+// sign of a server claiming every name is registered. Failed checks are
+// reported and don't mark their TLD
+func (worker *LookupWorker) checkCatchAll(tlds map[string]int) map[string]bool {
+	label := catchAllLabel()
+	catchAll := make(map[string]bool)
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, warmupConcurrency)
+	for tld := range tlds {
+		if tld == "" {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(tld string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+			defer cancel()
+			servers := worker.rdapServers(ctx, tld)
+			if len(servers) == 0 {
+				return
+			}
+			domain := label + "." + tld
+			result := worker.lookupServer(ctx, domain, tld, servers[0])
+			switch {
+			case result.Failed():
+				warnLog.Printf("catch-all check of %s: %s answered %s", tld, redact(servers[0]), result.Message)
+			case result.Message != messageUnregistered:
+				warnLog.Printf("catch-all check of %s: %s answered %s for the random %s, it may claim every name registered, its results are marked unreliable",
+					tld, redact(servers[0]), result.Message, domain)
+				mu.Lock()
+				catchAll[tld] = true
+				mu.Unlock()
+			default:
+				verboseLog.Printf("catch-all check of %s: %s is unregistered", tld, domain)
+			}
+		}(tld)
+	}
+	wg.Wait()
+	return catchAll
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// clientOptions configures the client used for RDAP queries
+type clientOptions struct {
+	// local addresses to rotate requests across, any when empty
+	bindIPs []string
+
+	// idle connections kept per RDAP server
+	maxIdlePerHost int
+
+	// client certificate for mutual TLS
+	certificates []tls.Certificate
+
+	// force HTTP/1.1 for servers misbehaving with HTTP/2
+	disableHTTP2 bool
+
+	// skip verifying server certificates
+	insecure bool
+
+	// addresses of RDAP hosts resolved by the warmup, nil to always resolve
+	dnsCache *dnsCache
+
+	// directory to save responses to with -record, or to serve them from
+	// instead of the network with -replay
+	record, replay string
+
+	// body limit and stall window of -record reading responses, see
+	// LookupWorker
+	maxBody   int64
+	readStall time.Duration
+}
+
+// loadClientCertificate loads the certificate/key pair for mutual TLS,
+// failing when only one of them is given or they don't match
+func loadClientCertificate(certFile, keyFile string) ([]tls.Certificate, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("-client-cert and -client-key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// newTransport returns a transport dialing from localIP, or from any local
+// address when localIP is nil. It keeps up to maxIdlePerHost idle connections
+// per RDAP server so concurrent lookups and retries reuse them
+func newTransport(localIP net.IP, options *clientOptions) *http.Transport {
+	// DisableCompression stays false: requests don't set Accept-Encoding so
+	// the transport advertises gzip and transparently decodes responses
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.maxIdlePerHost > transport.MaxIdleConnsPerHost {
+		transport.MaxIdleConnsPerHost = options.maxIdlePerHost
+	}
+	if len(options.certificates) > 0 || options.insecure {
+		transport.TLSClientConfig = &tls.Config{
+			Certificates:       options.certificates,
+			InsecureSkipVerify: options.insecure,
+		}
+	}
+	// HTTP/2 multiplexes concurrent lookups to a server over one connection,
+	// HTTP/1.1 needs a connection per in-flight lookup
+	transport.ForceAttemptHTTP2 = !options.disableHTTP2
+	if options.disableHTTP2 {
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if localIP != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+		transport.DialContext = dialer.DialContext
+	}
+	if options.dnsCache != nil {
+		transport.DialContext = options.dnsCache.dialContext(dialer.DialContext)
+	}
+	return transport
+}
+
+// rotatingTransport round-robins requests across transports, e.g. one per
+// local address of a multi-homed host
+type rotatingTransport struct {
+	transports []http.RoundTripper
+	next       uint32
+}
+
+func (t *rotatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := atomic.AddUint32(&t.next, 1) - 1
+	return t.transports[i%uint32(len(t.transports))].RoundTrip(req)
+}
+
+// newHTTPClient returns the client used for RDAP queries. Requests rotate
+// across the bind IPs when given, and are recorded or replayed
+func newHTTPClient(options *clientOptions) (*http.Client, error) {
+	if options.replay != "" {
+		if options.record != "" {
+			return nil, errors.New("-record and -replay can't be combined")
+		}
+		return &http.Client{Transport: &replayTransport{dir: options.replay}}, nil
+	}
+
+	var transport http.RoundTripper
+	if len(options.bindIPs) == 0 {
+		transport = newTransport(nil, options)
+	} else {
+		transports := make([]http.RoundTripper, 0, len(options.bindIPs))
+		for _, s := range options.bindIPs {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid bind ip %q", s)
+			}
+			transports = append(transports, newTransport(ip, options))
+		}
+		transport = &rotatingTransport{transports: transports}
+	}
+	if options.record != "" {
+		if err := os.MkdirAll(options.record, 0o755); err != nil {
+			return nil, err
+		}
+		transport = &recordTransport{
+			next:      transport,
+			dir:       options.record,
+			maxBody:   options.maxBody,
+			readStall: options.readStall,
+		}
+	}
+	return &http.Client{Transport: transport}, nil
+}
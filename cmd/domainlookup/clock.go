@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+// clock tells the current time to time-based features, so tests can control
+// it. The zero value is the real time
+type clock func() time.Time
+
+// Now returns the current time
+func (c clock) Now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c()
+}
+
+// Since returns the time elapsed since t
+func (c clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Until returns the duration until t
+func (c clock) Until(t time.Time) time.Duration {
+	return t.Sub(c.Now())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// applyConfig sets the flags of fs not given on the command line from the
+// JSON object in path, keyed by flag name without the dash. Repeatable flags
+// take an array of values
+func applyConfig(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	values := map[string]interface{}{}
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	// keyed by the flag's value, aliases like -q and -quiet share one, so
+	// giving either of them keeps the config from setting the other
+	given := map[flag.Value]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Value] = true
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("config %s: unknown flag %q", path, name)
+		}
+		if given[f.Value] {
+			continue
+		}
+		list, ok := values[name].([]interface{})
+		if !ok {
+			list = []interface{}{values[name]}
+		}
+		for _, value := range list {
+			switch value.(type) {
+			case string, json.Number, bool:
+			default:
+				return fmt.Errorf("config %s: flag %q wants a string, number or boolean, got %v", path, name, value)
+			}
+			if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("config %s: flag %q value %v: %w", path, name, value, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestApplyConfigAliases(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		config    string
+		wantQuiet bool
+		wantC     int
+	}{
+		{"config applies", nil, `{"quiet": true, "c": 4}`, true, 4},
+		{"flag wins", []string{"-quiet=false"}, `{"quiet": true}`, false, 1},
+		{"short alias wins over the long name", []string{"-q=false"}, `{"quiet": true}`, false, 1},
+		{"long alias wins over the short name", []string{"-quiet=false", "-c", "2"}, `{"q": true, "c": 4}`, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			var quiet bool
+			var c int
+			fs.BoolVar(&quiet, "q", false, "")
+			fs.BoolVar(&quiet, "quiet", false, "")
+			fs.IntVar(&c, "c", 1, "")
+			fs.String("config", "", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			path := t.TempDir() + "/config.json"
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(fs, path); err != nil {
+				t.Fatal(err)
+			}
+			if quiet != tt.wantQuiet || c != tt.wantC {
+				t.Errorf("quiet = %v, c = %d, want %v, %d", quiet, c, tt.wantQuiet, tt.wantC)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// consensusLookup queries up to worker.consensus of apis at once and returns
+// the result of the classification a strict majority of them agree on.
+// Servers failing to answer don't vote, a split vote is Inconclusive
+func (worker *LookupWorker) consensusLookup(ctx context.Context, domain, tld string, apis []string) *DomainLookupResult {
+	if len(apis) > worker.consensus {
+		apis = apis[:worker.consensus]
+	}
+
+	results := make([]*DomainLookupResult, len(apis))
+	var wg sync.WaitGroup
+	for i, server := range apis {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			results[i] = worker.lookupServer(ctx, domain, tld, server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	votes := map[string]int{}
+	voters := 0
+	for _, result := range results {
+		if result.Failed() {
+			continue
+		}
+		votes[result.Message]++
+		voters++
+	}
+	if voters == 0 {
+		return results[0]
+	}
+	for _, result := range results {
+		if !result.Failed() && votes[result.Message]*2 > voters {
+			if votes[result.Message] < voters {
+				verboseLog.Printf("rdap servers of %s disagree: %v", domain, votes)
+			}
+			if worker.explain {
+				result.Explanation = fmt.Sprintf("%d of %d answering servers agree; %s", votes[result.Message], voters, result.Explanation)
+			}
+			return result
+		}
+	}
+
+	verboseLog.Printf("rdap servers of %s disagree: %v", domain, votes)
+	result := &DomainLookupResult{
+		Domain:  domain,
+		TLD:     tld,
+		Message: messageInconclusive,
+	}
+	if worker.explain {
+		result.Explanation = fmt.Sprintf("no strict majority of the answering servers: %v", votes)
+	}
+	return result
+}
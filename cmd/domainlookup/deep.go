@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaults of -deep-depth and -deep-requests
+const (
+	defaultDeepDepth    = 2
+	defaultDeepRequests = 20
+)
+
+// rdapGraphNode is an RDAP object of a domain's graph with -deep, as the
+// server sent it, with the objects it refers to: the registrar's record of
+// the domain, nameservers and entities
+type rdapGraphNode struct {
+	URL    string          `json:"url"`
+	Object json.RawMessage `json:"object,omitempty"`
+
+	// why the object couldn't be fetched, or wasn't for the request bound
+	Error string `json:"error,omitempty"`
+
+	Referral    *rdapGraphNode   `json:"referral,omitempty"`
+	Nameservers []*rdapGraphNode `json:"nameservers,omitempty"`
+	Entities    []*rdapGraphNode `json:"entities,omitempty"`
+}
+
+// rdapGraphObject is what -deep follows of any RDAP object
+type rdapGraphObject struct {
+	Links       []rdapLink       `json:"links"`
+	Entities    []rdapGraphChild `json:"entities"`
+	Nameservers []rdapGraphChild `json:"nameservers"`
+}
+
+// rdapGraphChild is an embedded entity or nameserver object
+type rdapGraphChild struct {
+	LDHName string     `json:"ldhName"`
+	Links   []rdapLink `json:"links"`
+}
+
+// selfLink returns the href of the self link of links, "" for none
+func selfLink(links []rdapLink) string {
+	for _, link := range links {
+		if link.Rel == "self" && link.Href != "" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// deepGraph fetches the objects a domain response refers to for -deep
+type deepGraph struct {
+	worker *LookupWorker
+	server string
+	depth  int
+
+	// requests left, shared by every fetch of the graph
+	budget int32
+
+	mu      sync.Mutex
+	visited map[string]bool
+}
+
+// queryGraph assembles the object graph of the domain response body of
+// query to server, following references up to worker.deepDepth objects deep
+// with at most worker.deepRequests requests
+func (worker *LookupWorker) queryGraph(ctx context.Context, server, query string, body []byte) *rdapGraphNode {
+	graph := &deepGraph{
+		worker:  worker,
+		server:  server,
+		depth:   worker.deepDepth,
+		budget:  int32(worker.deepRequests),
+		visited: map[string]bool{query: true},
+	}
+	root := &rdapGraphNode{URL: redact(query), Object: json.RawMessage(body)}
+	graph.expand(ctx, root, 1)
+	return root
+}
+
+// expand fetches the references of node, at level of the graph, and their
+// references in turn while the depth allows
+func (graph *deepGraph) expand(ctx context.Context, node *rdapGraphNode, level int) {
+	if level >= graph.depth {
+		return
+	}
+	object := &rdapGraphObject{}
+	if err := json.Unmarshal(node.Object, object); err != nil {
+		return
+	}
+
+	var children []*rdapGraphNode
+	add := func(href string) *rdapGraphNode {
+		graph.mu.Lock()
+		defer graph.mu.Unlock()
+		if href == "" || graph.visited[href] {
+			return nil
+		}
+		graph.visited[href] = true
+		child := &rdapGraphNode{URL: href}
+		children = append(children, child)
+		return child
+	}
+	node.Referral = add((&rdapDomain{Links: object.Links}).registrarLink())
+	for _, ns := range object.Nameservers {
+		href := selfLink(ns.Links)
+		if href == "" && ns.LDHName != "" {
+			href, _ = rdapObjectURL(graph.server, "nameserver", ns.LDHName)
+		}
+		if child := add(href); child != nil {
+			node.Nameservers = append(node.Nameservers, child)
+		}
+	}
+	for _, entity := range object.Entities {
+		if child := add(selfLink(entity.Links)); child != nil {
+			node.Entities = append(node.Entities, child)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, maxNameserverQueries)
+	for _, child := range children {
+		wg.Add(1)
+		go func(child *rdapGraphNode) {
+			defer wg.Done()
+			slots <- struct{}{}
+			graph.fetch(ctx, child)
+			<-slots
+			if child.Object != nil {
+				graph.expand(ctx, child, level+1)
+			}
+		}(child)
+	}
+	wg.Wait()
+}
+
+// fetch fetches the object of node within the request budget
+func (graph *deepGraph) fetch(ctx context.Context, node *rdapGraphNode) {
+	href := node.URL
+	node.URL = redact(href)
+	if atomic.AddInt32(&graph.budget, -1) < 0 {
+		node.Error = "not fetched, -deep-requests reached"
+		return
+	}
+	resp, body, err := graph.worker.getRetry(ctx, href)
+	if err != nil {
+		node.Error = err.Error()
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		node.Error = resp.Status
+		return
+	}
+	if !json.Valid(body) || !strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+		node.Error = "not a JSON object"
+		return
+	}
+	node.Object = json.RawMessage(body)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// discovery steps finding the RDAP servers of a TLD
+const (
+	// the IANA bootstrap
+	discoveryBootstrap = "bootstrap"
+	// -override entries
+	discoveryOverride = "override"
+	// a _rdap._tcp.<tld> SRV record. No registry is known to publish one yet,
+	// so this is speculative and off by default
+	discoveryDNS = "dns"
+
+	defaultDiscovery = discoveryBootstrap + "," + discoveryOverride
+)
+
+// parseDiscovery parses the comma separated discovery steps
+func parseDiscovery(s string) ([]string, error) {
+	var steps []string
+	for _, step := range strings.Split(s, ",") {
+		step = strings.TrimSpace(step)
+		switch step {
+		case discoveryBootstrap, discoveryOverride, discoveryDNS:
+			steps = append(steps, step)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown discovery step %q", step)
+		}
+	}
+	return steps, nil
+}
+
+// parseOverrides parses tld=url overrides, a TLD may be given several times
+func parseOverrides(overrides []string) (map[string][]string, error) {
+	m := make(map[string][]string)
+	for _, override := range overrides {
+		tld, url, ok := strings.Cut(override, "=")
+		tld = lookupTLD(tld)
+		url = strings.TrimSpace(url)
+		if !ok || tld == "" || url == "" {
+			return nil, fmt.Errorf("override %q is not tld=url", override)
+		}
+		m[tld] = append(m[tld], url)
+	}
+	return m, nil
+}
+
+// dnsHints caches the servers found in DNS per TLD, including misses
+type dnsHints struct {
+	mu      sync.Mutex
+	servers map[string][]string
+}
+
+// rdapServers returns the RDAP servers of tld from the first discovery step
+// that knows any. Without steps only the bootstrap is used
+func (worker *LookupWorker) rdapServers(ctx context.Context, tld string) []string {
+	steps := worker.discovery
+	if steps == nil {
+		steps = []string{discoveryBootstrap}
+	}
+	for _, step := range steps {
+		var servers []string
+		switch step {
+		case discoveryBootstrap:
+			servers = worker.rdapLookupMap[tld]
+		case discoveryOverride:
+			servers = worker.overrides[tld]
+		case discoveryDNS:
+			servers = worker.dnsServers(ctx, tld)
+		}
+		if len(servers) > 0 {
+			return servers
+		}
+	}
+	return nil
+}
+
+// dnsServers looks up the _rdap._tcp SRV record of tld, e.g.
+//
+//	_rdap._tcp.example. IN SRV 0 0 443 rdap.nic.example.
+//
+// means https://rdap.nic.example/
+func (worker *LookupWorker) dnsServers(ctx context.Context, tld string) []string {
+	worker.dnsHints.mu.Lock()
+	servers, ok := worker.dnsHints.servers[tld]
+	worker.dnsHints.mu.Unlock()
+	if ok {
+		return servers
+	}
+
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "rdap", "tcp", tld)
+	if err != nil {
+		verboseLog.Printf("no rdap srv record for %s: %v", tld, err)
+	}
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		if host == "" {
+			continue
+		}
+		if record.Port != 443 && record.Port != 0 {
+			host = net.JoinHostPort(host, strconv.Itoa(int(record.Port)))
+		}
+		servers = append(servers, "https://"+host+"/")
+	}
+
+	worker.dnsHints.mu.Lock()
+	if worker.dnsHints.servers == nil {
+		worker.dnsHints.servers = make(map[string][]string)
+	}
+	worker.dnsHints.servers[tld] = servers
+	worker.dnsHints.mu.Unlock()
+	return servers
+}
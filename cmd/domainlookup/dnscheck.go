@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// dnsCheckTimeout bounds the DNS lookups of a domain with -dns-check
+const dnsCheckTimeout = 3 * time.Second
+
+// dnsCheck is the DNS view of a registered domain with -dns-check
+type dnsCheck struct {
+	// whether the domain has NS records, registered domains without them
+	// may be on hold or inactive
+	Delegated   bool     `json:"delegated"`
+	Nameservers []string `json:"nameservers,omitempty"`
+	Addresses   []string `json:"addresses,omitempty"`
+
+	// why the lookup failed, other than the name not existing
+	Error string `json:"error,omitempty"`
+}
+
+// isNotFound reports whether err means the name or its records don't exist
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// checkDNS looks up the NS and address records of domain with the system
+// resolver
+func checkDNS(ctx context.Context, domain string) *dnsCheck {
+	ctx, cancel := context.WithTimeout(ctx, dnsCheckTimeout)
+	defer cancel()
+
+	check := &dnsCheck{}
+	nameservers, err := net.DefaultResolver.LookupNS(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		check.Error = err.Error()
+		return check
+	}
+	for _, ns := range nameservers {
+		check.Nameservers = append(check.Nameservers, strings.TrimSuffix(ns.Host, "."))
+	}
+	check.Delegated = len(check.Nameservers) > 0
+	if !check.Delegated {
+		return check
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		check.Error = err.Error()
+	}
+	for _, addr := range addrs {
+		check.Addresses = append(check.Addresses, addr.String())
+	}
+	return check
+}
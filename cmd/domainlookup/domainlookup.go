@@ -5,22 +5,42 @@ package main
 
 import (
 	"bufio"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 const (
 	defaultConcurrency = 256
+	defaultMaxBody     = 4 << 20
 )
 
+// errResponseTooLarge is returned for RDAP responses over the body limit
+var errResponseTooLarge = errors.New("response too large")
+
+// warnLog prints warnings and progress to stderr, -quiet discards them.
+// Errors that abort the run go through the standard logger
+var warnLog = log.New(os.Stderr, "", log.LstdFlags)
+
+// verboseLog prints details to stderr with -verbose
+var verboseLog = log.New(io.Discard, "", log.LstdFlags)
+
 // array flag. e.g. -d a.com -d b.com
 type arrayFlags []string
 
@@ -35,15 +55,225 @@ func (i *arrayFlags) Set(s string) error {
 
 // flags
 var (
+	fAdaptive       bool
+	fApex           bool
+	fAvailable      bool
+	fAdaptiveMin    int
+	fAdaptiveMax    int
+	fAdaptiveTarget float64
+
+	fAutoQPS    bool
+	fAutoQPSMin float64
+	fAutoQPSMax float64
+
+	fProgressFile string
+
+	fBootstrapCache string
+	fBootstrapStats bool
+	fBootstrapOrder string
+	fBootstrapTTL   time.Duration
+
+	fBasicAuth   string
+	fAuthFile    string
+	fBatchSize   int
+	fBatchPause  time.Duration
+	fBlockLimit  int
+	fBlockAction string
+	fBlockPause  time.Duration
+	fCatchAll    bool
+	fBindIP      arrayFlags
+	fClientCert  string
+	fClientKey   string
+	fChanged     string
+	fColumn      int
+	fCompareWho  bool
 	fConcurrency int
+	fConfig      string
+	fConsensus   int
+	fDiffAgainst string
+	fDNSCheck    bool
+	fDeep        bool
+	fDeepDepth   int
+	fDeepLimit   int
+	fDiscovery   string
 	fDomain      arrayFlags
+	fErrorsFile  string
+	fEvents      string
+	fExplain     bool
+	fFields      string
+	fFailFast    bool
 	fFile        string
+	fFromURLs    bool
+	fGlobalQPS   float64
+	fHead        bool
+	fInsecure    bool
+	fHTTP2       bool
+	fKeyword     string
+	fMaxBody     int64
+	fMaxLine     int
+	fMaxLength   int
+	fNoColor     bool
+	fOutput      string
+	fOut         string
+	fRotateSize  int64
+	fRotateEvery time.Duration
+	fOverride    arrayFlags
+	fPassthrough bool
+	fPattern     arrayFlags
+	fPrintSchema bool
+	fPriorityLen int
+	fPriorityKey arrayFlags
+	fQuiet       bool
+	fRaceServers bool
+	fReadStall   time.Duration
+	fRecord      string
+	fRunID       string
+	fEmbedRunID  bool
+	fReplay      string
+	fRerunErrors string
+	fReserved    arrayFlags
+	fResolveNS   bool
+	fRegistrarID string
+	fRegistrarRe string
+	fRegistrars  bool
+	fResultCache string
+	fResultTTL   time.Duration
+	fRetries     int
+	fRateHeaders bool
+	fSample      float64
+	fSeed        int64
+	fSortBy      string
+	fSQLite      string
+	fSplit       string
+	fStallWarn   time.Duration
+	fThick       bool
+	fTUI         bool
+	fType        string
+	fTypos       string
+	fTypoKinds   string
+	fTLDs        string
+	fTLDLimit    arrayFlags
+	fMapStatus   arrayFlags
+	fShapes      arrayFlags
+	fTimeout     time.Duration
+	fValidate    bool
+	fVerbose     bool
+	fWarmup      bool
+	fWebhook     string
+	fWebhookSize int
+	fWriteJobs   int
+
+	fStrictContentType bool
 )
 
 func init() {
+	flag.BoolVar(&fApex, "apex", false, "Look up the registrable domain of input hosts like mail.example.com by the public suffix list, once per domain")
+	flag.BoolVar(&fApex, "dedup-etld", false, "Same as -apex")
+	flag.BoolVar(&fAvailable, "available-only", false, "Only output unregistered domains")
+	flag.BoolVar(&fAdaptive, "adaptive", false, "Adapt concurrency, starting at -c, to keep the error rate under -adaptive-target")
+	flag.IntVar(&fAdaptiveMin, "adaptive-min", defaultAdaptiveMin, "Min concurrency of -adaptive")
+	flag.IntVar(&fAdaptiveMax, "adaptive-max", defaultAdaptiveMax, "Max concurrency of -adaptive")
+	flag.Float64Var(&fAdaptiveTarget, "adaptive-target", defaultAdaptiveTarget, "Max rolling rate of rate limited, timed out and server error lookups of -adaptive")
+	flag.BoolVar(&fAutoQPS, "auto-qps", false, "Pace each server at the rate its rate limit headers advertise, between -auto-qps-min and -auto-qps-max")
+	flag.Float64Var(&fAutoQPSMin, "auto-qps-min", defaultAutoQPSMin, "Min requests per second of -auto-qps")
+	flag.Float64Var(&fAutoQPSMax, "auto-qps-max", defaultAutoQPSMax, "Max requests per second of -auto-qps")
+	flag.StringVar(&fBootstrapCache, "bootstrap-cache", defaultBootstrapCache(), "File caching the RDAP bootstrap, empty to disable")
+	flag.BoolVar(&fBootstrapStats, "bootstrap-stats", false, "Print statistics of the RDAP bootstrap and exit")
+	flag.StringVar(&fBootstrapOrder, "bootstrap-order", defaultBootstrapOrder, "Comma separated RDAP bootstrap sources to try in turn: cache, network, embedded")
+	flag.DurationVar(&fBootstrapTTL, "bootstrap-ttl", defaultBootstrapTTL, "Max age of the cached RDAP bootstrap, 0 for no limit")
+	flag.StringVar(&fBasicAuth, "basic-auth", "", "HTTP basic auth user:password sent to -override servers, see also -basic-auth-file and $DOMAINLOOKUP_BASIC_AUTH")
+	flag.StringVar(&fAuthFile, "basic-auth-file", "", "File holding the user:password of -basic-auth, keeping it out of the process args")
+	flag.IntVar(&fBatchSize, "batch-size", 0, "Look up domains in batches of this size, pausing -batch-pause in between")
+	flag.DurationVar(&fBatchPause, "batch-pause", time.Minute, "Pause between batches of -batch-size")
+	flag.IntVar(&fBlockLimit, "block-threshold", 0, "Consecutive lookups answered 403 or 429 taken as the IP being blocked, 0 disables")
+	flag.StringVar(&fBlockAction, "block-action", blockPause, "What to do once -block-threshold is reached: pause for -block-pause or abort")
+	flag.DurationVar(&fBlockPause, "block-pause", defaultBlockPause, "Pause of -block-action pause")
+	flag.BoolVar(&fCatchAll, "catch-all-check", false, "Look up a random name under each input TLD at startup and mark the results of TLDs whose server claims it registered as unreliable")
+	flag.Var(&fBindIP, "bind-ip", "Local IP to query RDAP from, requests rotate across repeated flags")
+	flag.StringVar(&fClientCert, "client-cert", "", "PEM client certificate for RDAP servers requiring mutual TLS")
+	flag.StringVar(&fClientKey, "client-key", "", "PEM private key of -client-cert")
+	flag.BoolVar(&fCompareWho, "compare-whois", false, "Also query WHOIS for conclusive results and report whether status and expiration agree with RDAP")
+	flag.IntVar(&fColumn, "column", 0, "1 based CSV column of -f holding the domain, 0 when lines are bare domains")
+	flag.StringVar(&fChanged, "changed-since", "", "Only output domains whose last changed event is on or after this RFC 3339 time or 2006-01-02 date")
 	flag.IntVar(&fConcurrency, "c", defaultConcurrency, "Max QPS lookups RDAP. Default is 256")
 	flag.Var(&fDomain, "d", "Domain to check")
-	flag.StringVar(&fFile, "f", "", "Domains file to check, one domain per line")
+	flag.StringVar(&fDiscovery, "discovery", defaultDiscovery, "Comma separated steps finding the RDAP servers of a TLD, tried in turn: bootstrap, override, dns")
+	flag.BoolVar(&fExplain, "explain", false, "Describe how each result was classified: the request, its answer, retries and the rule applied")
+	flag.StringVar(&fFields, "fields", "", "Comma separated fields of -o csv columns or json keys in order, e.g. domain,status,expires")
+	flag.BoolVar(&fFailFast, "fail-fast", false, "Stop at the first failed lookup and exit non-zero after flushing the output so far")
+	flag.StringVar(&fErrorsFile, "errors-file", "", "File to write failed domains to, one per line, truncated on start")
+	flag.StringVar(&fEvents, "events", "", "File, truncated on start, or fd:N to write JSON lines of progress events to for frontends")
+	flag.StringVar(&fDiffAgainst, "diff-against", "", "Previous CSV or JSON output, only print domains whose status changed since")
+	flag.BoolVar(&fDeep, "deep", false, "Also fetch the RDAP objects registered domains refer to, registrar record, nameservers and entities, into a nested graph")
+	flag.IntVar(&fDeepDepth, "deep-depth", defaultDeepDepth, "Max depth of the -deep graph, 1 being the domain object")
+	flag.IntVar(&fDeepLimit, "deep-requests", defaultDeepRequests, "Max requests of the -deep graph of a domain")
+	flag.BoolVar(&fDNSCheck, "dns-check", false, "Also look up the NS and address records of registered domains and flag those not delegated")
+	flag.BoolVar(&fFromURLs, "from-urls", false, "Look up the host of -f lines that are URLs like https://user@example.com:8080/path")
+	flag.StringVar(&fFile, "f", "", "Domains file or http(s) URL to check, one domain per line")
+	flag.Float64Var(&fGlobalQPS, "global-qps", 0, "Max RDAP requests per second across all servers, 0 for no limit")
+	flag.BoolVar(&fHead, "head", false, "Look domains up with HEAD requests, falling back to GET where unsupported. Registration details, including reserved statuses, aren't fetched")
+	flag.BoolVar(&fInsecure, "insecure", false, "Skip verifying the TLS certificates of RDAP servers")
+	flag.BoolVar(&fHTTP2, "http2", true, "Use HTTP/2 with servers supporting it, false forces HTTP/1.1")
+	flag.StringVar(&fKeyword, "keyword", "", "Keyword to check under every TLD of -tlds")
+	flag.IntVar(&fMaxLength, "max-length", 0, "Only output unregistered domains whose name without the TLD is at most this many characters, 0 for any")
+	flag.IntVar(&fMaxLine, "max-line", defaultMaxLine, "Max bytes of a -f line, longer lines are skipped with a warning")
+	flag.Int64Var(&fMaxBody, "max-body", defaultMaxBody, "Max bytes of an RDAP response body")
+	flag.BoolVar(&fNoColor, "no-color", false, "Don't color -o text output, also disabled by NO_COLOR or when stdout isn't a terminal")
+	flag.StringVar(&fOut, "out", "", "File to append results to instead of stdout")
+	flag.Int64Var(&fRotateSize, "rotate-size", 0, "Rotate -out once it reaches this many bytes, 0 never")
+	flag.DurationVar(&fRotateEvery, "rotate-interval", 0, "Rotate -out once it's been written to for this long, 0 never")
+	flag.StringVar(&fOutput, "o", outputCSV, "Output format, csv, json, text for reading in a terminal or gob for Go consumers")
+	flag.Var(&fOverride, "override", "RDAP server of a TLD as tld=url, used by the override discovery step. A url with {domain} is a template of the whole query")
+	flag.BoolVar(&fPassthrough, "passthrough", false, "Carry the other -column input columns into the output")
+	flag.StringVar(&fProgressFile, "progress-file", "", "File replaced every second with a JSON snapshot of the run's progress for monitoring")
+	flag.Var(&fPattern, "pattern", "Domain pattern to expand and check, e.g. brand.{com,net} or word{1..3}.com")
+	flag.BoolVar(&fPrintSchema, "print-schema", false, "Print the JSON schema of -o json results and exit")
+	flag.IntVar(&fPriorityLen, "priority-maxlen", 0, "Look up domains whose name without the TLD is at most this long first")
+	flag.Var(&fPriorityKey, "priority-keyword", "Look up domains containing this keyword first")
+	flag.BoolVar(&fQuiet, "quiet", false, "Only print results, errors that abort the run are still printed")
+	flag.BoolVar(&fQuiet, "q", false, "Shorthand for -quiet")
+	flag.DurationVar(&fReadStall, "read-stall", defaultReadStall, "Abort responses whose body advances less than 512 bytes in this long as Slow response, 0 disables")
+	flag.BoolVar(&fRaceServers, "race-servers", false, "Query all RDAP servers of a TLD at once and use the first conclusive answer, cancelling the others")
+	flag.StringVar(&fRunID, "run-id", "", "ID of the run for -embed-run-id and -events, generated from the start time when empty")
+	flag.BoolVar(&fEmbedRunID, "embed-run-id", false, "Add the run ID to each result as run_id")
+	flag.StringVar(&fRecord, "record", "", "Directory to save every RDAP response to for -replay")
+	flag.StringVar(&fReplay, "replay", "", "Directory of -record responses to serve RDAP requests from instead of the network")
+	flag.StringVar(&fRerunErrors, "rerun-errors", "", "Previous CSV or JSON output to check the failed domains of again")
+	flag.Var(&fReserved, "reserved-status", "Additional RDAP status value marking a domain as reserved")
+	flag.BoolVar(&fResolveNS, "resolve-nameservers", false, "Query the RDAP nameserver objects of registered domains")
+	flag.BoolVar(&fRateHeaders, "throttle-rate-headers", false, "Hold requests to a server whose X-RateLimit-Remaining reached 0 until its X-RateLimit-Reset")
+	flag.IntVar(&fRetries, "retries", defaultRetries, "Max retries of a rate limited (429) or connection reset lookup")
+	flag.StringVar(&fConfig, "config", "", "JSON file of flag defaults keyed by flag name, flags given on the command line win")
+	flag.IntVar(&fConsensus, "consensus", 1, "Query up to this many RDAP servers of a TLD and report the majority classification, Inconclusive when they disagree")
+	flag.StringVar(&fRegistrarID, "registrar-id", "", "Only output registered domains whose registrar has this IANA ID")
+	flag.BoolVar(&fRegistrars, "registrar-summary", false, "Print the number of registered domains per registrar on stderr at the end")
+	flag.StringVar(&fRegistrarRe, "registrar-match", "", "Only output registered domains whose registrar name matches this case-insensitive regexp")
+	flag.StringVar(&fResultCache, "result-cache", "", "Directory caching conclusive results across runs, fresh ones are served without a query")
+	flag.DurationVar(&fResultTTL, "result-ttl", defaultResultTTL, "Max age of a -result-cache result, 0 for no limit")
+	flag.StringVar(&fSplit, "split-output", "", "Directory to write the results of each TLD to, as <tld>.csv, .json or .txt by -o, instead of stdout")
+	flag.StringVar(&fSQLite, "sqlite", "", "Also upsert results into the results table of this SQLite database, needs a build with -tags sqlite")
+	flag.DurationVar(&fStallWarn, "stall-warn", defaultStallWarn, "Warn when the output takes no result for this long, 0 disables")
+	flag.StringVar(&fSortBy, "sort-by", "", "Buffer all results and emit them sorted by domain, tld, status or expiry")
+	flag.StringVar(&fType, "type", objectDomain, "What the input is: domain, ip for IP addresses or asn for AS numbers, looked up with the IANA IP and ASN bootstraps")
+	flag.BoolVar(&fTUI, "tui", false, "Show live progress counts on stderr, redrawn in place on a terminal")
+	flag.StringVar(&fTypos, "typos", "", "Check typo variations of this domain")
+	flag.StringVar(&fTypoKinds, "typo-kinds", defaultTypoKinds, "Comma separated -typos variations: omission, swap, repetition, hyphen and tld (with -tlds)")
+	flag.BoolVar(&fThick, "thick", false, "Query the registrar's RDAP record referred to by thin registries like com for full data")
+	flag.DurationVar(&fTimeout, "timeout", defaultTimeout, "Per domain lookup timeout including retries, 0 for none")
+	flag.Float64Var(&fSample, "sample", 1, "Fraction of input domains to randomly check, e.g. 0.1 for about 10%")
+	flag.Int64Var(&fSeed, "seed", 0, "Random seed of -sample for reproducible runs, 0 seeds with the time")
+	flag.Var(&fTLDLimit, "tld-concurrency", "Max concurrent lookups of a TLD as tld=N, for fragile servers")
+	flag.Var(&fShapes, "request-shape", "Shape the queries of a TLD's picky servers as tld=option[,option] with options uppercase or lowercase for the domain and slash for a trailing slash")
+	flag.Var(&fMapStatus, "map-status", "Classify an HTTP status code as registered, unregistered, reserved or inconclusive, as code=category or for one TLD tld:code=category")
+	flag.StringVar(&fTLDs, "tlds", "", "Comma separated TLDs for -keyword and -typos, e.g. com,net,io")
+	flag.BoolVar(&fValidate, "validate-only", false, "Report how many input domains are valid and have RDAP servers without any network request, then exit")
+	flag.BoolVar(&fVerbose, "verbose", false, "Print details like the RDAP bootstrap source used")
+	flag.BoolVar(&fVerbose, "v", false, "Shorthand for -verbose")
+	flag.StringVar(&fWebhook, "webhook", "", "Also POST results as JSON arrays to this URL")
+	flag.IntVar(&fWebhookSize, "webhook-batch", 1, "Results per -webhook post")
+	flag.IntVar(&fWriteJobs, "write-workers", 0, "Format results on this many goroutines and write them buffered, 0 writes each result directly")
+	flag.BoolVar(&fWarmup, "warmup", false, "Resolve the RDAP servers of the input's TLDs up front")
+	flag.BoolVar(&fStrictContentType, "strict-content-type", false, "Require an RDAP JSON content type before treating a 2xx response as registered")
 }
 
 // response example
@@ -72,7 +302,25 @@ type RdapDNS struct {
 
 type RdapDNSservice [][]string
 
-// return top domain -> rdap urls
+// sortServers returns a copy of servers with https ones first, each sorted
+// lexically, so the server queried first doesn't depend on bootstrap order
+func sortServers(servers []string) []string {
+	sorted := append([]string(nil), servers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := isHTTPS(sorted[i]), isHTTPS(sorted[j])
+		if a != b {
+			return a
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+func isHTTPS(server string) bool {
+	return strings.HasPrefix(strings.ToLower(server), "https://")
+}
+
+// return top domain -> rdap urls, see sortServers for their order
 func (dns *RdapDNS) LookupMap() (m map[string][]string, err error) {
 	if dns == nil || len(dns.Services) == 0 {
 		return nil, errors.New("rdap services is empty")
@@ -83,8 +331,9 @@ func (dns *RdapDNS) LookupMap() (m map[string][]string, err error) {
 		if len(service) != 2 {
 			return nil, fmt.Errorf("service is not a tuple. service %+v", service)
 		}
+		servers := sortServers(service[1])
 		for _, topdomain := range service[0] {
-			m[topdomain] = service[1]
+			m[topdomain] = servers
 		}
 	}
 	return m, nil
@@ -96,40 +345,263 @@ func rdapDNSInfo(dnsURL string) (dns *RdapDNS, err error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rdap bootstrap %s: %s", dnsURL, resp.Status)
+	}
+
+	dns, err = decodeRdapDNS(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("rdap bootstrap %s: %w", dnsURL, err)
 	}
+	return dns, nil
+}
 
+// decodeRdapDNS decodes a bootstrap file as it streams in, so a truncated
+// download fails as soon as the stream ends
+func decodeRdapDNS(r io.Reader) (dns *RdapDNS, err error) {
 	dns = &RdapDNS{}
-	err = json.Unmarshal(body, &dns)
-	return
+	if err = json.NewDecoder(r).Decode(dns); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated bootstrap: %w", err)
+		}
+		return nil, err
+	}
+	return dns, nil
 }
 
-// domainlookup result
+// lookup messages
+const (
+	messageRegistered            = "Registered"
+	messageUnregistered          = "Unregistered"
+	messageReserved              = "Reserved"
+	messageBadRequest            = "Bad request (malformed domain?)"
+	messageNoServer              = "No RDAP server found"
+	messageServerError           = "RDAP server error"
+	messageUnexpectedContentType = "Unexpected content type"
+	messageRateLimited           = "Rate limited"
+	messageTimeout               = "Timeout"
+	messageResponseTooLarge      = "Response too large"
+	messageUnknownError          = "Unknown error"
+	messageUnauthorized          = "Unauthorized, check -basic-auth"
+	messageForbidden             = "Forbidden"
+	messageNoRecording           = "No recording to replay"
+	messageSlowResponse          = "Slow response"
+	messageInconclusive          = "Inconclusive"
+	messageNoTLD                 = "Invalid domain (no TLD)"
+	messageConnectionReset       = "Connection reset"
+	messageTLSInvalid            = "TLS certificate invalid, try -insecure"
+	messageTLSTimeout            = "TLS handshake timeout, the server may be overloaded"
+	messageDNSFailed             = "RDAP server name not resolved, check DNS"
+	messageConnectionRefused     = "Connection refused, the RDAP server may be down"
+	messageNoRoute               = "No route to host, check the network or -bind-ip"
+	messageInvalidIP             = "Invalid IP address"
+	messageInvalidASN            = "Invalid AS number"
+)
+
+// domainlookup result, the -o json output contract. Fields tagged omitempty
+// are left out when empty, the others are always present. Keep
+// outputSchemaVersion in step with changes
 type DomainLookupResult struct {
-	Domain  string
-	Message string
-	Result  *RdapLookupResult
+	Domain  string            `json:"domain"`
+	TLD     string            `json:"tld"`
+	Message string            `json:"message"`
+	Result  *RdapLookupResult `json:"result,omitempty"`
+
+	// message of the domain in the -diff-against run
+	PreviousMessage string `json:"previous_message,omitempty"`
+
+	// other columns of the input line with -passthrough
+	Extra []string `json:"extra,omitempty"`
+
+	// input host the domain was reduced from with -apex
+	Input string `json:"input,omitempty"`
+
+	// served from -result-cache rather than looked up
+	Cached bool `json:"cached,omitempty"`
+
+	// WHOIS cross-check with -compare-whois
+	Whois *whoisComparison `json:"whois,omitempty"`
+
+	// DNS records of a registered domain with -dns-check
+	DNS *dnsCheck `json:"dns,omitempty"`
+
+	// how the message was arrived at with -explain
+	Explanation string `json:"explanation,omitempty"`
+
+	// ID of the run that looked the domain up with -embed-run-id
+	RunID string `json:"run_id,omitempty"`
+
+	// the TLD's server claimed a random name registered with -catch-all-check
+	Unreliable bool `json:"unreliable,omitempty"`
+
+	// position of the domain in the input
+	index int
+
+	// HTTP status the message was classified from, an error object's code
+	// replacing a 2xx one, 0 when no server answered
+	statusCode int
 }
 
 // RdapLookupResult of protocl
 type RdapLookupResult struct {
+	// RDAP server that answered
+	Server string `json:"server,omitempty"`
+
+	Status    []string `json:"status,omitempty"`
+	Registrar string   `json:"registrar,omitempty"`
+	Reseller  string   `json:"reseller,omitempty"`
+	Events    []Event  `json:"events,omitempty"`
+
+	// IANA registrar ID
+	RegistrarID string `json:"registrar_id,omitempty"`
+
+	Nameservers []Nameserver `json:"nameservers,omitempty"`
+
+	// host of the WHOIS server the response refers to
+	Port43 string `json:"port43,omitempty"`
+
+	// the objects the response refers to with -deep
+	Graph *rdapGraphNode `json:"graph,omitempty"`
+
+	// whether the server withheld data, e.g. contacts for privacy, and what
+	Redacted       bool     `json:"redacted,omitempty"`
+	RedactedFields []string `json:"redacted_fields,omitempty"`
+	// error object of an unsuccessful response
+	Error *RdapError `json:"error,omitempty"`
 }
 
 type LookupWorker struct {
-	unchecked <-chan string
+	unchecked <-chan lookupInput
+
+	client *http.Client
 
 	rdapLookupMap map[string][]string
 
+	// servers of IPs or AS numbers with -type ip or asn, nil for domains
+	numbers *numberBootstrap
+
+	// tld -> rdap urls from -override
+	overrides map[string][]string
+
+	// discovery steps tried in turn to find the servers of a TLD
+	discovery []string
+
+	dnsHints dnsHints
+
 	concurrencies chan struct{}
 
+	// lower concurrency caps of some TLDs
+	tldLimits tldLimits
+
+	// -map-status classifications replacing the default of status codes
+	statusMap statusMap
+
+	// casing and trailing slash of the queries of picky servers
+	shapes requestShapes
+
 	concurrencyLimit int
 
+	// replaces the fixed concurrencies with a limit adapting to errors
+	adaptive *adaptiveLimiter
+
+	// pause batchPause after every batchSize domains, 0 for no batches
+	batchSize  int
+	batchPause time.Duration
+
+	// pauses or stops the lookups when the IP seems blocked, nil never
+	blocks *blockWatch
+
+	// per domain deadline covering retries, 0 means no deadline
+	timeout time.Duration
+
+	// look domains up with HEAD requests, falling back to GET with servers
+	// in noHead or answering 405
+	head   bool
+	noHead serverSet
+
+	// max retries of rate limited (429) responses and connection resets
+	retries int
+
+	// max bytes read of a response body, defaultMaxBody when 0
+	maxBody int64
+
+	// window a response body must advance slowBodyBytes in, 0 for no limit
+	readStall time.Duration
+
+	// caps the rate of all RDAP requests, nil for no cap
+	globalLimiter *tokenBucket
+
+	// paces each server by its advertised limit, nil without -auto-qps
+	pacer *serverPacer
+
+	// credentials of -override servers, nil without -basic-auth
+	auth *basicAuth
+
+	// rate limit budgets servers advertised, nil to ignore them
+	budgets *rateBudgets
+
+	// current time of time-based features, real time when nil
+	now clock
+
+	// only treat 2xx as registered when the response is RDAP JSON
+	strictContentType bool
+
+	// follow registrar referrals of thin registries for the full record
+	thick bool
+
+	// query the nameserver objects of registered domains
+	resolveNameservers bool
+
+	// assemble the object graph of registered domains, deepDepth objects
+	// deep with up to deepRequests requests, when deep
+	deep         bool
+	deepDepth    int
+	deepRequests int
+
+	// query up to this many of a TLD's servers and report the majority
+	consensus int
+
+	// query all of a TLD's servers and take the fastest conclusive answer
+	raceServers bool
+
+	inflight flightGroup
+
+	// warn when the Result consumer takes no result for this long, 0 never
+	stallWarn time.Duration
+	watch     resultWatch
+
+	// conclusive results of earlier runs, nil without -result-cache
+	results *resultCache
+
+	// WHOIS client comparing results with -compare-whois, nil otherwise
+	whois *whoisClient
+
+	// look up the NS and address records of registered domains
+	dnsCheck bool
+
+	// describe how each result was classified
+	explain bool
+
+	// TLDs failing -catch-all-check, whose results are marked unreliable
+	catchAll map[string]bool
+
+	// resultHook, when set, may annotate or change each result before it is
+	// sent on Result. The command is package main and can't be imported, so
+	// it is for code added to this package, not embedders. It runs on the
+	// lookup goroutines, so up to the concurrency limit calls run at once and
+	// it must be safe for concurrent use. Each call gets its own result,
+	// duplicates included
+	resultHook func(*DomainLookupResult)
+
 	Result chan *DomainLookupResult
 }
 
 func (worker *LookupWorker) topdomain(domain string) string {
+	return topdomain(domain)
+}
+
+// topdomain returns the last label of domain
+func topdomain(domain string) string {
 	if domain == "" {
 		return ""
 	}
@@ -137,128 +609,1113 @@ func (worker *LookupWorker) topdomain(domain string) string {
 	return arr[len(arr)-1]
 }
 
-func (worker *LookupWorker) rdapLookupURL(rdap string, domain string) string {
-	return fmt.Sprintf("%s/domain/%s", rdap, domain)
+// isRdapContentType reports whether contentType is application/rdap+json or
+// application/json, see RFC 7480 section 4.2
+func isRdapContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/rdap+json" || mediaType == "application/json"
+}
+
+// rdapLookupURL returns the domain query of the rdap base URL
+func (worker *LookupWorker) rdapLookupURL(rdap string, domain string) (string, error) {
+	if worker.numbers != nil {
+		return rdapObjectURL(rdap, worker.objectPath(), domain)
+	}
+	tld := worker.topdomain(domain)
+	shape := worker.shapes[tld]
+	if isURLTemplate(rdap) {
+		return expandURLTemplate(rdap, shape.name(domain), tld)
+	}
+	query, err := rdapObjectURL(rdap, worker.objectPath(), shape.name(domain))
+	if err != nil {
+		return "", err
+	}
+	return shape.url(query), nil
+}
+
+// placeholders of -override URL templates
+const (
+	templateDomain = "{domain}"
+	templateTLD    = "{tld}"
+)
+
+// isURLTemplate reports whether rdap is a URL template for servers with
+// non-standard query shapes rather than a base URL
+func isURLTemplate(rdap string) bool {
+	return strings.Contains(rdap, templateDomain)
+}
+
+// withScheme trims the spaces of an rdap URL and adds https:// when it has
+// no scheme
+func withScheme(rdap string) string {
+	rdap = strings.TrimSpace(rdap)
+	if !strings.Contains(rdap, "://") {
+		rdap = "https://" + rdap
+	}
+	return rdap
+}
+
+// expandURLTemplate returns the domain query of the URL template, with
+// https:// added when it has no scheme
+func expandURLTemplate(template, domain, tld string) (string, error) {
+	query := withScheme(template)
+	query = strings.ReplaceAll(query, templateDomain, url.PathEscape(domain))
+	query = strings.ReplaceAll(query, templateTLD, url.PathEscape(tld))
+
+	u, err := url.Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid rdap url template %q: %w", template, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("invalid rdap url template %q", template)
+	}
+	return u.String(), nil
+}
+
+// rdapObjectURL returns the query of an object like domain or nameserver of
+// the rdap base URL. The base gets https:// when it has no scheme and loses
+// trailing slashes, the name is path escaped
+func rdapObjectURL(rdap, objectType, name string) (string, error) {
+	if isURLTemplate(rdap) {
+		return "", fmt.Errorf("rdap url template %q only serves domain queries", rdap)
+	}
+	base := strings.TrimRight(withScheme(rdap), "/")
+
+	u, err := url.Parse(fmt.Sprintf("%s/%s/%s", base, objectType, url.PathEscape(name)))
+	if err != nil {
+		return "", fmt.Errorf("invalid rdap url %q: %w", rdap, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("invalid rdap url %q", rdap)
+	}
+	return u.String(), nil
 }
 
 // looks like verisign response 404 means domain is not registered. so we
 // only to check the response http status
 // NOTE: we ONLY support top domain like com, net at this moment
-func (worker *LookupWorker) queryRdap(rdap, domain string) (resp *http.Response, err error) {
-	query := worker.rdapLookupURL(rdap, domain)
-	resp, err = http.Get(query)
+func (worker *LookupWorker) queryRdap(ctx context.Context, rdap, domain string) (resp *http.Response, body []byte, err error) {
+	query, err := worker.rdapLookupURL(rdap, domain)
+	if err != nil {
+		return
+	}
+	if worker.head && !worker.noHead.has(rdap) {
+		resp, body, err = worker.requestRetry(ctx, http.MethodHead, query)
+		if err != nil || (resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented) {
+			return
+		}
+		if worker.noHead.add(rdap) {
+			verboseLog.Printf("rdap server %s doesn't support HEAD, using GET", rdap)
+		}
+		if trace := traceOf(ctx); trace != nil {
+			trace.headFallback = true
+		}
+	}
+	return worker.getRetry(ctx, query)
+}
+
+// request requests query once, reading the body up to the size limit
+func (worker *LookupWorker) request(ctx context.Context, method, query string) (resp *http.Response, body []byte, err error) {
+	if worker.globalLimiter != nil {
+		if err = worker.globalLimiter.Wait(ctx); err != nil {
+			return
+		}
+	}
+
+	// cancelled by the stall guard of the body
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, query, nil)
+	if err != nil {
+		return
+	}
+	worker.auth.apply(req)
+	if err = worker.pacer.Wait(ctx, req.URL.Host); err != nil {
+		return
+	}
+	if worker.budgets != nil {
+		worker.budgets.Wait(ctx, req.URL.Host)
+	}
+	resp, err = worker.client.Do(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
-	_, err = io.ReadAll(resp.Body)
+	if worker.budgets != nil {
+		worker.budgets.Observe(req.URL.Host, resp.Header)
+	}
+	worker.pacer.Observe(req.URL.Host, resp.Header)
+
+	var r io.Reader = resp.Body
+	if worker.readStall > 0 {
+		guard := newStallGuard(resp.Body, worker.readStall, cancel)
+		defer func() {
+			if guard.Stop() && err != nil {
+				err = errSlowResponse
+			}
+		}()
+		r = guard
+	}
+
+	// the transport asks for and decodes gzip itself, this covers servers
+	// compressing unasked. The limit applies to the decoded body. HEAD and
+	// empty responses have no body to decode
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") &&
+		method != http.MethodHead && resp.ContentLength != 0 {
+		gz, gzErr := gzip.NewReader(r)
+		if gzErr != nil {
+			return resp, nil, gzErr
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	maxBody := worker.maxBody
+	if maxBody <= 0 {
+		maxBody = defaultMaxBody
+	}
+	body, err = readBody(r, maxBody+1)
+	if err == nil && int64(len(body)) > maxBody {
+		err = errResponseTooLarge
+	}
 	return
 }
 
+// lookup queries RDAP for a single domain
+func (worker *LookupWorker) lookup(domain string) *DomainLookupResult {
+	ctx := context.Background()
+	if worker.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, worker.timeout)
+		defer cancel()
+	}
+
+	if worker.numbers != nil {
+		return worker.lookupNumber(ctx, domain)
+	}
+
+	tld := worker.topdomain(domain)
+	if tld == "" || tld == domain {
+		// a bare word like localhost is malformed, not an unsupported TLD
+		result := &DomainLookupResult{
+			Domain:  domain,
+			Message: messageNoTLD,
+		}
+		if worker.explain {
+			result.Explanation = "the name has no dot separating a TLD"
+		}
+		return result
+	}
+	apis := worker.rdapServers(ctx, tld)
+	if len(apis) == 0 {
+		result := &DomainLookupResult{
+			Domain:  domain,
+			TLD:     tld,
+			Message: messageNoServer,
+		}
+		if worker.explain {
+			result.Explanation = fmt.Sprintf("no -discovery step (%s) found an RDAP server of %s", strings.Join(worker.discovery, ","), tld)
+		}
+		return result
+	}
+
+	var result *DomainLookupResult
+	if worker.consensus > 1 && len(apis) > 1 {
+		result = worker.consensusLookup(ctx, domain, tld, apis)
+	} else if worker.raceServers && len(apis) > 1 {
+		result = worker.raceLookup(ctx, domain, tld, apis)
+	} else {
+		result = worker.lookupServer(ctx, domain, tld, apis[0])
+	}
+	if worker.whois != nil && !result.Failed() {
+		result.Whois = worker.compareWhois(ctx, domain, tld, result)
+	}
+	if worker.dnsCheck && result.Message == messageRegistered {
+		result.DNS = checkDNS(ctx, domain)
+	}
+	return result
+}
+
+// lookupServer classifies domain by the answer of a single RDAP server
+func (worker *LookupWorker) lookupServer(ctx context.Context, domain, tld, server string) *DomainLookupResult {
+	queryCtx := ctx
+	var trace *lookupTrace
+	if worker.explain {
+		trace = &lookupTrace{}
+		queryCtx = withTrace(ctx, trace)
+	}
+	resp, body, err := worker.queryRdap(queryCtx, server, domain)
+	if err != nil {
+		message := errorMessage(err)
+		if message != err.Error() {
+			verboseLog.Printf("%s: %v", domain, err)
+		}
+		result := &DomainLookupResult{
+			Domain:  domain,
+			TLD:     tld,
+			Message: message,
+		}
+		if trace != nil {
+			result.Explanation = explainError(trace, server, err)
+		}
+		return result
+	}
+
+	statusCode := resp.StatusCode
+	rdapErr := decodeRdapError(body)
+	if rdapErr != nil && rdapErr.Code >= 400 && statusCode >= 200 && statusCode < 300 {
+		// some servers answer 200 with an error object
+		verboseLog.Printf("rdap server %s answered %s with error %d", server, domain, rdapErr.Code)
+		statusCode = rdapErr.Code
+	}
+	message, mapped := worker.statusMap.message(tld, statusCode)
+	var result *RdapLookupResult
+	switch {
+	case mapped:
+		if trace != nil {
+			trace.mappedStatus = true
+		}
+		if message != messageUnregistered && statusCode >= 200 && statusCode < 300 {
+			if domainObject, err := decodeRdapDomain(body); err == nil {
+				result = domainObject.lookupResult()
+			}
+		}
+	case statusCode >= 200 && statusCode < 300:
+		message = messageRegistered
+		if worker.strictContentType && !isRdapContentType(resp.Header.Get("Content-Type")) {
+			message = messageUnexpectedContentType
+			break
+		}
+		// registration details are best effort, the status code decides
+		domainObject, err := decodeRdapDomain(body)
+		if err != nil {
+			break
+		}
+		result = domainObject.lookupResult()
+		if isReserved(result.Status) {
+			message = messageReserved
+			break
+		}
+		if worker.thick {
+			worker.queryThick(ctx, domainObject, result)
+		}
+		if worker.resolveNameservers {
+			worker.queryNameservers(ctx, server, result.Nameservers)
+		}
+		if worker.deep {
+			result.Graph = worker.queryGraph(ctx, server, resp.Request.URL.String(), body)
+		}
+	case statusCode == 400:
+		message = messageBadRequest
+		verboseLog.Printf("rdap server rejected %s as malformed", resp.Request.URL.Redacted())
+	case statusCode == 401:
+		message = messageUnauthorized
+	case statusCode == 403:
+		// refusing the IP or query, credentials would get a 401
+		message = messageForbidden
+	case statusCode == 404:
+		message = messageUnregistered
+	case statusCode == 429:
+		message = messageRateLimited
+	case statusCode >= 500:
+		message = messageServerError
+	default:
+		message = messageUnknownError
+	}
+	if result == nil {
+		result = &RdapLookupResult{}
+	}
+	if statusCode >= 300 {
+		result.Error = rdapErr
+	}
+	result.Server = redact(server)
+	lookupResult := &DomainLookupResult{
+		Domain:     domain,
+		TLD:        tld,
+		Message:    message,
+		Result:     result,
+		statusCode: statusCode,
+	}
+	if trace != nil {
+		lookupResult.Explanation = explainResponse(trace, resp, statusCode, message, result)
+	}
+	return lookupResult
+}
+
 func (worker *LookupWorker) Start() {
 	wg := sync.WaitGroup{}
 
-	for domain := range worker.unchecked {
-		wg.Add(1)
+	if worker.stallWarn > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go worker.watchdog(worker.stallWarn, stop)
+	}
+
+	dispatched := 0
+	for input := range worker.unchecked {
+		if worker.batchSize > 0 && dispatched > 0 && dispatched%worker.batchSize == 0 {
+			// let the batch finish before pausing
+			wg.Wait()
+			verboseLog.Printf("batch %d of %d domains done, pausing %v", dispatched/worker.batchSize, worker.batchSize, worker.batchPause)
+			time.Sleep(worker.batchPause)
+		}
+		if !worker.blocks.Check() {
+			break
+		}
+		dispatched++
+
+		domain := input.domain
+		if worker.numbers == nil {
+			domain = lookupName(domain)
+		}
+		lookup := queuedLookup{input: input, domain: domain}
+		// a lookup of a TLD at its -tld-concurrency waits in the TLD's queue,
+		// holding no -c slot, and the other TLDs go on
+		if worker.tldLimits.acquire(worker.topdomain(domain), lookup) {
+			worker.dispatch(&wg, lookup)
+		}
+	}
+
+	wg.Wait()
+	if worker.adaptive != nil {
+		warnLog.Printf("adaptive concurrency settled at %d", worker.adaptive.Limit())
+	}
+	close(worker.Result)
+}
+
+// dispatch takes a -c slot and looks lookup up, which holds its TLD's slot.
+// Its end hands the TLD slot to the next lookup queued for it
+func (worker *LookupWorker) dispatch(wg *sync.WaitGroup, lookup queuedLookup) {
+	wg.Add(1)
+	if worker.adaptive != nil {
+		worker.adaptive.Acquire()
+	} else {
 		worker.concurrencies <- struct{}{}
+	}
 
-		go func(domain string) {
-			defer func() {
+	go func() {
+		input, domain := lookup.input, lookup.domain
+		var result *DomainLookupResult
+		defer func() {
+			if worker.adaptive != nil {
+				worker.adaptive.Release(result)
+			} else {
 				<-worker.concurrencies
-				wg.Done()
-			}()
-
-			apis, ok := worker.rdapLookupMap[worker.topdomain(domain)]
-			if !ok || len(apis) == 0 {
-				worker.Result <- &DomainLookupResult{
-					Domain:  domain,
-					Message: "No RDAP server found",
+			}
+			tld := worker.topdomain(domain)
+			for {
+				next, ok := worker.tldLimits.release(tld)
+				if !ok {
+					break
 				}
-				return
+				if worker.blocks.Check() {
+					worker.dispatch(wg, next)
+					break
+				}
+				// the run stops, the queued lookups are dropped
 			}
+			wg.Done()
+		}()
 
-			resp, err := worker.queryRdap(apis[0], domain)
-			if err != nil {
-				worker.Result <- &DomainLookupResult{
-					Domain:  domain,
-					Message: err.Error(),
+		// duplicates of an in-flight domain share its request
+		result, _ = worker.inflight.Do(domain, func() *DomainLookupResult {
+			if worker.results == nil {
+				return worker.lookup(domain)
+			}
+			if cached, ok := worker.results.Get(domain); ok {
+				if worker.explain {
+					cached.Explanation = strings.TrimSuffix("served from -result-cache; "+cached.Explanation, "; ")
 				}
-				return
+				return cached
 			}
-
-			statusCode := resp.StatusCode
-			message := ""
-			switch {
-			case statusCode >= 200 && statusCode < 300:
-				message = "Registered"
-			case statusCode == 404:
-				message = "Unregistered"
-			case statusCode >= 500:
-				message = "RDAP server error"
-			default:
-				message = "Unknown error"
+			result := worker.lookup(domain)
+			worker.results.Put(domain, result)
+			return result
+		})
+		if worker.catchAll[result.TLD] {
+			result.Unreliable = true
+			if worker.explain {
+				result.Explanation = strings.TrimPrefix(result.Explanation+"; the server of the TLD claimed a random name registered, it may be a catch-all", "; ")
 			}
-			worker.Result <- &DomainLookupResult{
-				Domain:  domain,
-				Message: message,
+		}
+		worker.blocks.Record(result)
+		result.Extra = input.extra
+		result.index = input.index
+		result.Input = input.original
+		if worker.resultHook != nil {
+			worker.resultHook(result)
+		}
+		worker.sendResult(result)
+	}()
+}
+
+// readInput sends the domains of -f to send in order
+func readInput(send func(lookupInput)) error {
+	reader := &inputReader{column: fColumn, passthrough: fPassthrough, maxLine: fMaxLine, fromURLs: fFromURLs}
+	return reader.Read(fFile, send)
+}
+
+// loadInput reads -f into memory once for the features needing its TLDs
+// before the first lookup, sendInput then sends it from memory. It is
+// non-nil when there is no -f
+func loadInput() ([]lookupInput, error) {
+	loaded := []lookupInput{}
+	if fFile == "" {
+		return loaded, nil
+	}
+	err := readInput(func(input lookupInput) {
+		loaded = append(loaded, input)
+	})
+	return loaded, err
+}
+
+// inputTLDs returns the number of domains per TLD of -d, generated, rerun
+// and the loaded -f input
+func inputTLDs(generated, rerun []string, loaded []lookupInput) map[string]int {
+	tlds := make(map[string]int)
+	for _, list := range [][]string{fDomain, generated, rerun} {
+		for _, domain := range list {
+			tlds[resultTLD(domain)]++
+		}
+	}
+	for _, input := range loaded {
+		tlds[resultTLD(input.domain)]++
+	}
+	return tlds
+}
+
+// resultTLD is the TLD the result of looking up name will have
+func resultTLD(name string) string {
+	if fType != objectDomain {
+		return ""
+	}
+	clean, _ := cleanInput(name)
+	domain := lookupName(clean)
+	if tld := topdomain(domain); tld != domain {
+		return tld
+	}
+	return ""
+}
+
+// sendInput sends the input domains to unchecked in order and closes it. -f
+// is read unless it was loaded, when loaded isn't nil
+func sendInput(unchecked chan<- lookupInput, generated, rerun []string, loaded []lookupInput, sample *sampler, progress *progress) {
+	index := 0
+	var apex *apexReducer
+	if fApex {
+		apex = newApexReducer()
+	}
+	send := func(input lookupInput) {
+		if clean, stripped := cleanInput(input.domain); len(stripped) > 0 {
+			verboseLog.Printf("input %q: stripped %s", input.domain, strings.Join(stripped, ", "))
+			input.domain = clean
+		}
+		if apex != nil && !apex.Reduce(&input) {
+			return
+		}
+		if sample == nil || sample.keep() {
+			input.index = index
+			index++
+			if progress != nil {
+				progress.Queue(resultTLD(input.domain))
 			}
-		}(domain)
+			unchecked <- input
+		}
 	}
 
-	wg.Wait()
-	close(worker.Result)
+	for _, domain := range fDomain {
+		send(lookupInput{domain: domain})
+	}
+	for _, domain := range generated {
+		send(lookupInput{domain: domain})
+	}
+	for _, domain := range rerun {
+		send(lookupInput{domain: domain})
+	}
+	if loaded != nil {
+		for _, input := range loaded {
+			send(input)
+		}
+	} else if fFile != "" {
+		if err := readInput(send); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if apex != nil {
+		warnLog.Printf("-apex collapsed %d hosts sharing a registrable domain, %d registrable domains left", apex.collapsed, len(apex.seen))
+	}
+	if sample != nil {
+		warnLog.Printf("sampled %d of %d domains", sample.kept, sample.seen)
+	}
+	if progress != nil {
+		progress.InputDone()
+	}
+	close(unchecked)
+}
+
+// untilDone passes on results until ctx is done, abandoning the lookups in
+// flight then
+func untilDone(ctx context.Context, results <-chan *DomainLookupResult) <-chan *DomainLookupResult {
+	out := make(chan *DomainLookupResult)
+	go func() {
+		defer close(out)
+		for result := range results {
+			select {
+			case out <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
 }
 
 func main() {
 	flag.Parse()
 
-	if len(fDomain) == 0 && fFile == "" {
+	if fConfig != "" {
+		if err := applyConfig(flag.CommandLine, fConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if fQuiet {
+		warnLog.SetOutput(io.Discard)
+	} else if fVerbose {
+		verboseLog.SetOutput(os.Stderr)
+	}
+
+	if fPrintSchema {
+		if err := printSchema(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	for _, status := range fReserved {
+		reservedStatuses[strings.ToLower(strings.TrimSpace(status))] = true
+	}
+
+	if len(fDomain) == 0 && fFile == "" && !fBootstrapStats && len(fPattern) == 0 && fKeyword == "" && fTypos == "" && fRerunErrors == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	rdapDNS, err := rdapDNSInfo(rdapDNSURL)
+	runID := fRunID
+	if runID == "" {
+		runID = newRunID(time.Now())
+	}
+	verboseLog.Printf("run %s", runID)
+
+	if err := validateInputFlags(fColumn, fPassthrough); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateType(fType); err != nil {
+		log.Fatal(err)
+	}
+	if fRaceServers && fConsensus > 1 {
+		log.Fatal("-race-servers and -consensus both pick among a TLD's servers, use one")
+	}
+	if fValidate && isURLInput(fFile) {
+		log.Fatal("-validate-only doesn't fetch -f URLs")
+	}
+	if flags := fullRecordFlags(); fHead && len(flags) > 0 {
+		log.Fatalf("-head doesn't fetch the record needed by %s", strings.Join(flags, ", "))
+	}
+
+	generated, err := generateDomains(fPattern, fKeyword, fTLDs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if fTypos != "" {
+		typos, err := typoDomains(fTypos, fTypoKinds, fTLDs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		generated = append(generated, typos...)
+	}
+
+	var rerun []string
+	if fRerunErrors != "" {
+		if rerun, err = failedDomains(fRerunErrors); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	var outFile *rotatingFile
+	if fOutput == outputGob && (fRotateSize != 0 || fRotateEvery != 0) {
+		// gob isn't line based and a file after the first would lack its types
+		log.Fatal("-o gob can't be rotated by -rotate-size or -rotate-interval")
+	}
+	if fOut != "" {
+		if outFile, err = openRotatingFile(fOut, fRotateSize, fRotateEvery, nil); err != nil {
+			log.Fatal(err)
+		}
+		out = outFile
+	} else if fRotateSize != 0 || fRotateEvery != 0 {
+		log.Fatal("-rotate-size and -rotate-interval need -out")
+	}
+
+	outputOptions := outputOptions{
+		previous: fDiffAgainst != "",
+		input:    fApex,
+		explain:  fExplain,
+		color:    fOut == "" && fSplit == "" && useColor(os.Stdout, fNoColor),
+	}
+	if fFields != "" {
+		if outputOptions.fields, err = parseFields(fFields); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var writer resultWriter
+	var parallel, split resultStore
+	if fSplit != "" {
+		if fOut != "" || fWriteJobs > 0 {
+			log.Fatal("-split-output writes its own files, drop -out and -write-workers")
+		}
+		split, err = newSplitWriter(fSplit, fOutput, outputOptions)
+		writer = split
+	} else if fWriteJobs > 0 {
+		parallel, err = newParallelWriter(out, fOutput, outputOptions, fWriteJobs)
+		writer = parallel
+	} else {
+		writer, err = newResultWriter(out, fOutput, outputOptions)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	var changedSince time.Time
+	if fChanged != "" {
+		if changedSince, err = parseDate(fChanged); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var registrarMatch *regexp.Regexp
+	if fRegistrarRe != "" {
+		if registrarMatch, err = regexp.Compile("(?i)" + fRegistrarRe); err != nil {
+			log.Fatalf("invalid -registrar-match: %v", err)
+		}
+	}
+	// an interrupt ends the run like -fail-fast, flushing the output so far
+	// and letting the webhook give up, a second one kills it
+	runCtx, stopRun := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopRun()
+	go func() {
+		<-runCtx.Done()
+		stopRun()
+	}()
+
+	// stores get every result besides the output
+	var stores []resultStore
+	if fSQLite != "" {
+		store, err := openSQLiteStore(fSQLite, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stores = append(stores, store)
+	}
+	if fWebhook != "" {
+		store, err := newWebhookStore(runCtx, fWebhook, fWebhookSize, fTimeout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stores = append(stores, store)
+	}
+	var sorter *resultSorter
+	if fSortBy != "" {
+		if sorter, err = newResultSorter(fSortBy); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	discovery, err := parseDiscovery(fDiscovery)
+	if err != nil {
+		log.Fatal(err)
+	}
+	overrides, err := parseOverrides(fOverride)
+	if err != nil {
+		log.Fatal(err)
+	}
+	limits, err := parseTLDLimits(fTLDLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	statuses, err := parseStatusMap(fMapStatus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shapes, err := parseRequestShapes(fShapes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth, err := loadBasicAuth(fBasicAuth, fAuthFile, overrides)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var errorsFile *bufio.Writer
+	if fErrorsFile != "" {
+		file, err := os.Create(fErrorsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		errorsFile = bufio.NewWriter(file)
+	}
+	var events *eventWriter
+	if fEvents != "" {
+		if events, err = openEvents(fEvents, runID, nil); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var previous map[string]string
+	if fDiffAgainst != "" {
+		if previous, err = previousMessages(fDiffAgainst); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	certificates, err := loadClientCertificate(fClientCert, fClientKey)
 	if err != nil {
 		log.Fatal(err)
 	}
-	rdapMap, err := rdapDNS.LookupMap()
+	var warmupCache *dnsCache
+	if fWarmup {
+		warmupCache = &dnsCache{}
+	}
+	client, err := newHTTPClient(&clientOptions{
+		bindIPs:        fBindIP,
+		maxIdlePerHost: fConcurrency,
+		certificates:   certificates,
+		disableHTTP2:   !fHTTP2,
+		insecure:       fInsecure,
+		dnsCache:       warmupCache,
+		record:         fRecord,
+		replay:         fReplay,
+		maxBody:        fMaxBody,
+		readStall:      fReadStall,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	unchecked := make(chan string)
+	bootstrap := &bootstrapLoader{
+		order:     fBootstrapOrder,
+		dnsURL:    rdapDNSURL,
+		embedded:  embeddedRdapDNS,
+		cachePath: fBootstrapCache,
+		cacheTTL:  fBootstrapTTL,
+	}
+	if fValidate {
+		bootstrap.order = offlineOrder(bootstrap.order)
+	}
+	// the bootstrap loads while the input starts being read
+	var rdapMap map[string][]string
+	var numbers *numberBootstrap
+	bootstrapped := make(chan error, 1)
+	go func() {
+		if fType != objectDomain {
+			var err error
+			numbers, err = loadNumberBootstrap(fType, bootstrap)
+			bootstrapped <- err
+			return
+		}
+		rdapDNS, _, err := bootstrap.Load()
+		if err == nil {
+			rdapMap, err = rdapDNS.LookupMap()
+		}
+		bootstrapped <- err
+	}()
+
+	// buffered to have the first batch read when the bootstrap is ready
+	unchecked := make(chan lookupInput, fConcurrency)
+	var progress *progress
+	// TLDs of the input, read once up front for -warmup and -catch-all-check
+	var tlds map[string]int
+	var loaded []lookupInput
+	if !fBootstrapStats && !fValidate {
+		if fWarmup || fCatchAll {
+			var err error
+			if loaded, err = loadInput(); err != nil {
+				log.Fatal(err)
+			}
+			tlds = inputTLDs(generated, rerun, loaded)
+		}
+		sample, err := newSampler(fSample, fSeed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if fTUI || fProgressFile != "" {
+			var out io.Writer
+			if fTUI {
+				out = os.Stderr
+			}
+			progress = newProgress(out, fTUI && isTerminal(os.Stderr), fProgressFile, nil)
+			// count the input for the ETA when it's loaded, or else a local
+			// file in a pass not keeping it in memory
+			if tlds != nil {
+				progress.SetTotals(tlds)
+			} else if !isURLInput(fFile) {
+				totals := inputTLDs(generated, rerun, nil)
+				if fFile != "" {
+					err := readInput(func(input lookupInput) {
+						totals[resultTLD(input.domain)]++
+					})
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+				progress.SetTotals(totals)
+			}
+		}
+		go sendInput(unchecked, generated, rerun, loaded, sample, progress)
+	}
+
+	if err := <-bootstrapped; err != nil {
+		log.Fatal(err)
+	}
+
+	if fBootstrapStats {
+		if err := newBootstrapStats(rdapMap).Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if fValidate {
+		report := newInputReport(offlineServers(rdapMap, overrides, discovery))
+		for _, list := range [][]string{fDomain, generated, rerun} {
+			for _, domain := range list {
+				report.Add(domain)
+			}
+		}
+		if fFile != "" {
+			reader := &inputReader{column: fColumn, maxLine: fMaxLine, fromURLs: fFromURLs}
+			err := reader.Read(fFile, func(input lookupInput) {
+				report.Add(input.domain)
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := report.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var queue <-chan lookupInput = unchecked
+	if isPriority := priorityPredicate(fPriorityLen, fPriorityKey); isPriority != nil {
+		queue = prioritize(unchecked, isPriority)
+	}
 	lookupWorker := &LookupWorker{
-		unchecked:        unchecked,
+		unchecked:        queue,
+		client:           client,
 		rdapLookupMap:    rdapMap,
+		numbers:          numbers,
+		overrides:        overrides,
+		discovery:        discovery,
+		auth:             auth,
 		concurrencies:    make(chan struct{}, fConcurrency),
+		tldLimits:        limits,
+		statusMap:        statuses,
+		shapes:           shapes,
 		concurrencyLimit: fConcurrency,
-		Result:           make(chan *DomainLookupResult),
+		batchSize:        fBatchSize,
+		batchPause:       fBatchPause,
+
+		timeout:           fTimeout,
+		retries:           fRetries,
+		maxBody:           fMaxBody,
+		readStall:         fReadStall,
+		strictContentType: fStrictContentType,
+		thick:             fThick,
+
+		resolveNameservers: fResolveNS,
+		deep:               fDeep,
+		deepDepth:          fDeepDepth,
+		deepRequests:       fDeepLimit,
+		consensus:          fConsensus,
+		raceServers:        fRaceServers,
+		head:               fHead,
+		stallWarn:          fStallWarn,
+		explain:            fExplain,
+		dnsCheck:           fDNSCheck,
+
+		Result: make(chan *DomainLookupResult),
+	}
+	if fAdaptive {
+		lookupWorker.adaptive = newAdaptiveLimiter(fConcurrency, fAdaptiveMin, fAdaptiveMax, fAdaptiveTarget)
+	}
+	if fGlobalQPS > 0 {
+		lookupWorker.globalLimiter = newTokenBucket(fGlobalQPS, 1, lookupWorker.now)
+	}
+	lookupWorker.budgets = newRateBudgets(fRateHeaders, lookupWorker.now)
+	if fBlockLimit > 0 {
+		if lookupWorker.blocks, err = newBlockWatch(fBlockLimit, fBlockAction, fBlockPause); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if fAutoQPS {
+		if fAutoQPSMin <= 0 || fAutoQPSMax < fAutoQPSMin {
+			log.Fatal("-auto-qps needs 0 < -auto-qps-min <= -auto-qps-max")
+		}
+		lookupWorker.pacer = newServerPacer(fAutoQPSMin, fAutoQPSMax, lookupWorker.now)
+	}
+	if fDeep && (fDeepDepth < 1 || fDeepLimit < 0) {
+		log.Fatal("-deep needs -deep-depth >= 1 and -deep-requests >= 0")
+	}
+	if fCompareWho {
+		lookupWorker.whois = newWhoisClient()
+	}
+	if fResultCache != "" {
+		cache, err := newResultCache(fResultCache, fResultTTL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lookupWorker.results = cache
 	}
 
+	if fWarmup {
+		lookupWorker.warmup(warmupCache, tlds)
+	}
+	if fCatchAll {
+		lookupWorker.catchAll = lookupWorker.checkCatchAll(tlds)
+	}
+
+	if events != nil {
+		if err := events.Start(); err != nil {
+			log.Fatal(err)
+		}
+	}
 	go lookupWorker.Start()
 
-	go func() {
-		for _, domain := range fDomain {
-			unchecked <- domain
+	// keep reports whether result passes the output filters
+	keep := func(result *DomainLookupResult) bool {
+		if fAvailable && result.Message != messageUnregistered {
+			return false
 		}
-		if fFile != "" {
-			file, err := os.Open(fFile)
-			if err != nil {
+		if fMaxLength > 0 && result.Message == messageUnregistered && result.nameLength() > fMaxLength {
+			return false
+		}
+		if previous != nil && !changed(previous, result) {
+			return false
+		}
+		if fRegistrarID != "" && !result.hasRegistrarID(fRegistrarID) {
+			return false
+		}
+		if registrarMatch != nil && !result.registrarMatches(registrarMatch) {
+			return false
+		}
+		if fChanged != "" && !result.changedSince(changedSince) {
+			return false
+		}
+		return true
+	}
+
+	var registrars *registrarSummary
+	if fRegistrars {
+		registrars = newRegistrarSummary()
+	}
+
+	var failed *DomainLookupResult
+	for result := range untilDone(runCtx, lookupWorker.Result) {
+		if fEmbedRunID {
+			result.RunID = runID
+		}
+		if progress != nil {
+			progress.Record(result)
+		}
+		if events != nil {
+			if err := events.Record(result); err != nil {
 				log.Fatal(err)
 			}
-			defer file.Close()
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				unchecked <- scanner.Text()
+		}
+		if registrars != nil {
+			registrars.Add(result)
+		}
+		for _, store := range stores {
+			if err := store.Write(result); err != nil {
+				log.Fatal(err)
 			}
-			if err := scanner.Err(); err != nil {
+		}
+		if errorsFile != nil && result.Failed() {
+			if _, err := fmt.Fprintln(errorsFile, result.Domain); err != nil {
 				log.Fatal(err)
 			}
 		}
-		close(unchecked)
-	}()
+		if keep(result) {
+			if sorter != nil {
+				sorter.Add(result)
+			} else if err := writer.Write(result); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if fFailFast && result.Failed() {
+			// in-flight lookups are abandoned, what was written is flushed
+			failed = result
+			break
+		}
+	}
+	if progress != nil {
+		progress.Stop()
+	}
+	if sorter != nil {
+		for _, result := range sorter.Sorted() {
+			if err := writer.Write(result); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
 
-	for result := range lookupWorker.Result {
-		fmt.Printf("%s,%s\n", result.Domain, result.Message)
+	if parallel != nil {
+		if err := parallel.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if split != nil {
+		if err := split.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if outFile != nil {
+		if err := outFile.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if errorsFile != nil {
+		if err := errorsFile.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if events != nil {
+		if err := events.Finish(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, store := range stores {
+		if err := store.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if registrars != nil {
+		// on stderr like the warnings, so -quiet leaves only the results
+		if err := registrars.Print(warnLog.Writer()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if failed != nil {
+		log.Fatalf("-fail-fast: %s: %s", failed.Domain, failed.Message)
+	}
+	if runCtx.Err() != nil {
+		log.Fatal("interrupted, the results so far were written")
+	}
+	if err := lookupWorker.blocks.Err(); err != nil {
+		log.Fatal(err)
 	}
 }
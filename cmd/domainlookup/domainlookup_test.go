@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestServer serves handler for the test and returns a worker querying
+// it and its URL as the RDAP base
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*LookupWorker, string) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &LookupWorker{client: srv.Client()}, srv.URL
+}
+
+// serveRdap answers every query with status, contentType and body
+func serveRdap(status int, contentType, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func TestLookupServerContentType(t *testing.T) {
+	const domainJSON = `{"objectClassName":"domain","ldhName":"example.com"}`
+	tests := []struct {
+		name        string
+		strict      bool
+		contentType string
+		body        string
+		want        string
+	}{
+		{"html not strict", false, "text/html", "<html>not found</html>", messageRegistered},
+		{"html strict", true, "text/html; charset=utf-8", "<html>not found</html>", messageUnexpectedContentType},
+		{"rdap json strict", true, "application/rdap+json", domainJSON, messageRegistered},
+		{"json strict", true, "application/json; charset=utf-8", domainJSON, messageRegistered},
+		{"no content type strict", true, "", domainJSON, messageUnexpectedContentType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, serveRdap(http.StatusOK, tt.contentType, tt.body))
+			worker.strictContentType = tt.strict
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRdapDNSTruncated(t *testing.T) {
+	full := embeddedRdapDNS
+	tests := []struct {
+		name    string
+		body    []byte
+		wantErr string
+	}{
+		{"complete", full, ""},
+		{"cut in services", full[:len(full)/2], "truncated bootstrap"},
+		{"cut before the end", full[:len(full)-2], "truncated bootstrap"},
+		{"cut in a string", []byte(`{"publication": "2024-`), "truncated bootstrap"},
+		{"not json", []byte(`<html>`), "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dns, err := decodeRdapDNS(bytes.NewReader(tt.body))
+			if tt.wantErr == "" {
+				if err != nil || len(dns.Services) == 0 {
+					t.Fatalf("got %v, error %v", dns, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRdapDNSInfoTruncatedDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(embeddedRdapDNS[:100])
+	}))
+	defer srv.Close()
+
+	_, err := rdapDNSInfo(srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "truncated bootstrap") || !strings.Contains(err.Error(), srv.URL) {
+		t.Fatalf("error = %v, want a truncated bootstrap error naming the URL", err)
+	}
+}
+
+func TestLookupServerMaxBody(t *testing.T) {
+	const maxBody = 1024
+	tests := []struct {
+		name    string
+		maxBody int64
+		size    int
+		want    string
+	}{
+		{"under the limit", maxBody, maxBody - 10, messageRegistered},
+		{"at the limit", maxBody, maxBody, messageRegistered},
+		{"over the limit", maxBody, maxBody + 1, messageResponseTooLarge},
+		{"far over the limit", maxBody, 50 * maxBody, messageResponseTooLarge},
+		{"default limit", 0, 50 * maxBody, messageRegistered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a JSON string padded to size bytes
+			body := `"` + strings.Repeat("x", tt.size-2) + `"`
+			worker, server := newTestServer(t, serveRdap(http.StatusOK, "application/rdap+json", body))
+			worker.maxBody = tt.maxBody
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestRdapLookupURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		domain  string
+		want    string
+		wantErr bool
+	}{
+		{"no trailing slash", "https://rdap.example/v1", "example.com", "https://rdap.example/v1/domain/example.com", false},
+		{"trailing slash", "https://rdap.example/v1/", "example.com", "https://rdap.example/v1/domain/example.com", false},
+		{"trailing slashes", "https://rdap.example/v1//", "example.com", "https://rdap.example/v1/domain/example.com", false},
+		{"no scheme", "rdap.example/v1/", "example.com", "https://rdap.example/v1/domain/example.com", false},
+		{"http kept", "http://rdap.example/", "example.com", "http://rdap.example/domain/example.com", false},
+		{"spaces trimmed", " https://rdap.example/ ", "example.com", "https://rdap.example/domain/example.com", false},
+		{"escaped domain", "https://rdap.example/", "a/b?c#d.com", "https://rdap.example/domain/a%2Fb%3Fc%23d.com", false},
+		{"template", "https://rdap.example/lookup?name={domain}&tld={tld}", "example.com", "https://rdap.example/lookup?name=example.com&tld=com", false},
+		{"bad scheme", "ftp://rdap.example/", "example.com", "", true},
+		{"no host", "https:///v1", "example.com", "", true},
+	}
+	worker := &LookupWorker{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := worker.rdapLookupURL(tt.base, tt.domain)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupServerStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{http.StatusOK, `{"objectClassName":"domain"}`, messageRegistered},
+		{http.StatusOK, `{"objectClassName":"domain","status":["reserved"]}`, messageReserved},
+		{http.StatusBadRequest, `{"errorCode":400,"title":"malformed query"}`, messageBadRequest},
+		{http.StatusBadRequest, "", messageBadRequest},
+		{http.StatusUnauthorized, "", messageUnauthorized},
+		{http.StatusForbidden, "", messageForbidden},
+		{http.StatusNotFound, "", messageUnregistered},
+		{http.StatusTooManyRequests, "", messageRateLimited},
+		{http.StatusInternalServerError, "", messageServerError},
+		{http.StatusServiceUnavailable, "", messageServerError},
+		{http.StatusTeapot, "", messageUnknownError},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			worker, server := newTestServer(t, serveRdap(tt.status, "application/rdap+json", tt.body))
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+		})
+	}
+}
+
+// captureLog sends the output of logger to the returned buffer for the test
+func captureLog(t *testing.T, logger *log.Logger) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	out := logger.Writer()
+	logger.SetOutput(buf)
+	t.Cleanup(func() { logger.SetOutput(out) })
+	return buf
+}
+
+func TestLookupServerBadRequestLogsQuery(t *testing.T) {
+	logged := captureLog(t, verboseLog)
+	worker, server := newTestServer(t, serveRdap(http.StatusBadRequest, "", ""))
+	worker.lookupServer(context.Background(), "bad_name.com", "com", server)
+	if want := server + "/domain/bad_name.com"; !strings.Contains(logged.String(), want) {
+		t.Errorf("verbose log %q doesn't name the query %s", logged, want)
+	}
+}
+
+func TestLoadInputTLDs(t *testing.T) {
+	path := t.TempDir() + "/domains.txt"
+	if err := os.WriteFile(path, []byte("a.com\nb.COM\nc.net\nexample.com:443\nlocalhost\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(file string, domains arrayFlags) { fFile, fDomain = file, domains }(fFile, fDomain)
+	fFile, fDomain = path, arrayFlags{"d.org"}
+
+	loaded, err := loadInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 5 {
+		t.Fatalf("loaded %d domains, want 5", len(loaded))
+	}
+	got := inputTLDs([]string{"e.net"}, nil, loaded)
+	want := map[string]int{"com": 3, "net": 2, "org": 1, "": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inputTLDs = %v, want %v", got, want)
+	}
+}
+
+func TestLookupNoTLD(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"localhost", messageNoTLD},
+		{"foo", messageNoTLD},
+		{"", messageNoTLD},
+		{"example.invalid", messageNoServer},
+	}
+	worker := &LookupWorker{rdapLookupMap: map[string][]string{}}
+	for _, tt := range tests {
+		if got := worker.lookup(tt.domain).Message; got != tt.want {
+			t.Errorf("lookup(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestSortServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []string
+		want    []string
+	}{
+		{"https first", []string{"http://a.example/", "https://b.example/"}, []string{"https://b.example/", "http://a.example/"}},
+		{"lexical", []string{"https://c.example/", "https://a.example/", "https://b.example/"}, []string{"https://a.example/", "https://b.example/", "https://c.example/"}},
+		{"both", []string{"http://b.example/", "HTTPS://z.example/", "http://a.example/", "https://y.example/"}, []string{"HTTPS://z.example/", "https://y.example/", "http://a.example/", "http://b.example/"}},
+		{"one", []string{"https://rdap.example/"}, []string{"https://rdap.example/"}},
+		{"none", nil, nil},
+	}
+	for _, tt := range tests {
+		servers := append([]string(nil), tt.servers...)
+		got := sortServers(servers)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: sortServers(%q) = %q, want %q", tt.name, tt.servers, got, tt.want)
+		}
+		if !reflect.DeepEqual(servers, tt.servers) {
+			t.Errorf("%s: sortServers changed its argument to %q", tt.name, servers)
+		}
+	}
+}
+
+func TestLookupMapServerOrder(t *testing.T) {
+	dns := &RdapDNS{Services: []RdapDNSservice{
+		{{"com", "net"}, {"http://rdap.verisign.example/", "https://rdap.verisign.example/"}},
+		{{"org"}, {"https://b.org.example/", "https://a.org.example/"}},
+	}}
+	got, err := dns.LookupMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"com": {"https://rdap.verisign.example/", "http://rdap.verisign.example/"},
+		"net": {"https://rdap.verisign.example/", "http://rdap.verisign.example/"},
+		"org": {"https://a.org.example/", "https://b.org.example/"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupMap = %v, want %v", got, want)
+	}
+	if first := dns.Services[0][1][0]; first != "http://rdap.verisign.example/" {
+		t.Errorf("LookupMap reordered the bootstrap to %q first", first)
+	}
+}
+
+// mainEnv marks a run of the test binary as the command, see runMain
+const mainEnv = "DOMAINLOOKUP_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(mainEnv) == "1" {
+		// the arguments are the command's, the test flags aren't parsed
+		os.Args[0] = "domainlookup"
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the command with args offline, against the embedded bootstrap,
+// and returns its output and exit code
+func runMain(t *testing.T, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-bootstrap-order", "embedded"}, args...)...)
+	cmd.Env = append(os.Environ(), mainEnv+"=1", "HOME="+t.TempDir())
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	default:
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+func TestFailFast(t *testing.T) {
+	tests := []struct {
+		name     string
+		failFast bool
+		want     []string
+		wantCode int
+	}{
+		{"stops at the failure", true, []string{"a.com", "b.com"}, 1},
+		{"without -fail-fast", false, []string{"a.com", "b.com", "c.com"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/b.com") {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/rdap+json")
+				w.Write([]byte(`{"objectClassName":"domain"}`))
+			})
+			args := []string{"-discovery", "override", "-override", "com=" + server, "-c", "1", "-retries", "0",
+				"-d", "a.com", "-d", "b.com", "-d", "c.com"}
+			if tt.failFast {
+				args = append(args, "-fail-fast")
+			}
+			stdout, stderr, code := runMain(t, args...)
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d, stderr %s", code, tt.wantCode, stderr)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+				got = append(got, strings.Split(line, ",")[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrote %q, want %q", got, tt.want)
+			}
+			if tt.failFast && !strings.Contains(stderr, "-fail-fast: b.com") {
+				t.Errorf("stderr %q doesn't name the failed lookup", stderr)
+			}
+		})
+	}
+}
+
+func TestRegistrarSummaryQuiet(t *testing.T) {
+	_, server := newTestServer(t, serveRdap(http.StatusOK, "application/rdap+json", string(benchDomainJSON)))
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"printed", nil, true},
+		{"-quiet", []string{"-quiet"}, false},
+		{"-q", []string{"-q"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-discovery", "override", "-override", "com=" + server, "-registrar-summary", "-d", "example.com"}, tt.args...)
+			stdout, stderr, code := runMain(t, args...)
+			if code != 0 {
+				t.Fatalf("exit code %d, stderr %s", code, stderr)
+			}
+			if !strings.HasPrefix(stdout, "example.com,") {
+				t.Errorf("stdout %q, want the result", stdout)
+			}
+			if got := strings.Contains(stderr, "Internet Assigned Numbers Authority"); got != tt.want {
+				t.Errorf("summary printed %v, want %v, stderr %q", got, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestRotateGobRefused(t *testing.T) {
+	_, server := newTestServer(t, serveRdap(http.StatusNotFound, "", ""))
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{"gob -rotate-size", []string{"-o", "gob", "-rotate-size", "100"}, 1},
+		{"gob -rotate-interval", []string{"-o", "gob", "-rotate-interval", "1h"}, 1},
+		{"gob", []string{"-o", "gob"}, 0},
+		{"csv -rotate-size", []string{"-rotate-size", "100"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir() + "/results"
+			args := append([]string{"-discovery", "override", "-override", "com=" + server, "-out", out, "-d", "a.com", "-d", "b.com"}, tt.args...)
+			_, stderr, code := runMain(t, args...)
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d, stderr %s", code, tt.wantCode, stderr)
+			}
+			if tt.wantCode != 0 && !strings.Contains(stderr, "-o gob can't be rotated") {
+				t.Errorf("stderr %q doesn't say why", stderr)
+			}
+			if _, err := os.Stat(out); (err == nil) != (tt.wantCode == 0) {
+				t.Errorf("output file exists %v, want %v", err == nil, tt.wantCode == 0)
+			}
+		})
+	}
+}
+
+func TestResultHook(t *testing.T) {
+	worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// long enough for the duplicates to share the request
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	domains := []string{"a.com", "b.com", "a.com", "c.net", "b.com", "a.com"}
+	const concurrency = 4
+	unchecked := make(chan lookupInput, len(domains))
+	for i, domain := range domains {
+		unchecked <- lookupInput{domain: domain, index: i}
+	}
+	close(unchecked)
+	worker.unchecked = unchecked
+	worker.rdapLookupMap = map[string][]string{"com": {server}, "net": {server}}
+	worker.concurrencies = make(chan struct{}, concurrency)
+	worker.Result = make(chan *DomainLookupResult, len(domains))
+
+	var calls, running, maxRunning int32
+	worker.resultHook = func(result *DomainLookupResult) {
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for prev := atomic.LoadInt32(&maxRunning); n > prev; prev = atomic.LoadInt32(&maxRunning) {
+			if atomic.CompareAndSwapInt32(&maxRunning, prev, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		result.Explanation += "hooked"
+	}
+	go worker.Start()
+
+	out := &bytes.Buffer{}
+	writer, err := newResultWriter(out, outputCSV, outputOptions{explain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for result := range worker.Result {
+		if err := writer.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&calls); got != int32(len(domains)) {
+		t.Errorf("hook called %d times, want once per input domain, %d", got, len(domains))
+	}
+	// the duplicates sharing a request run their hooks at once, on their own
+	// copies of the result, which -race checks
+	if got := atomic.LoadInt32(&maxRunning); got < 2 || got > concurrency {
+		t.Errorf("%d hook calls at once, want concurrent calls up to -c %d", got, concurrency)
+	}
+	written := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if n := strings.Count(line, "hooked"); n != 1 {
+			t.Errorf("line %q has the hook's change %d times, want once", line, n)
+		}
+		written[strings.Split(line, ",")[0]]++
+	}
+	if want := map[string]int{"a.com": 3, "b.com": 2, "c.net": 1}; !reflect.DeepEqual(written, want) {
+		t.Errorf("wrote %v, want %v", written, want)
+	}
+}
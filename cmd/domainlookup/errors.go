@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// errorMessage maps an error of a lookup request to its result message, with
+// a hint for common transport errors. Unknown errors keep their text
+func errorMessage(err error) string {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		dnsErr           *net.DNSError
+		netErr           net.Error
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return messageTimeout
+	case errors.Is(err, errResponseTooLarge):
+		return messageResponseTooLarge
+	case errors.Is(err, errSlowResponse):
+		return messageSlowResponse
+	case errors.Is(err, errNoRecording):
+		return messageNoRecording
+	case isConnectionReset(err):
+		return messageConnectionReset
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalidCert), errors.As(err, &hostname):
+		return messageTLSInvalid
+	case strings.Contains(err.Error(), "TLS handshake timeout"):
+		return messageTLSTimeout
+	case errors.As(err, &dnsErr):
+		return messageDNSFailed
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return messageConnectionRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return messageNoRoute
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return messageTimeout
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventsVersion is the version of the -events schema, bumped like
+// outputSchemaVersion
+const eventsVersion = "1.1"
+
+// event kinds of -events
+const (
+	eventStart    = "start"
+	eventProgress = "progress"
+	eventFinish   = "finish"
+)
+
+// progressEvent is a line of -events. Counts are cumulative, progress events
+// name the domain just done, start carries the schema version and finish the
+// elapsed time. Every event has the run ID
+type progressEvent struct {
+	Event   string    `json:"event"`
+	Version string    `json:"version,omitempty"`
+	RunID   string    `json:"run_id"`
+	Time    time.Time `json:"time"`
+	Domain  string    `json:"domain,omitempty"`
+
+	Done         int `json:"done"`
+	Registered   int `json:"registered"`
+	Unregistered int `json:"unregistered"`
+	Reserved     int `json:"reserved"`
+	Failed       int `json:"failed"`
+
+	ElapsedMS int64 `json:"elapsed_ms,omitempty"`
+}
+
+// eventWriter writes -events as JSON lines, apart from the results
+type eventWriter struct {
+	w     io.WriteCloser
+	enc   *json.Encoder
+	now   clock
+	start time.Time
+	last  progressEvent
+}
+
+// openEvents opens the -events target, a file truncated on start or fd:N
+// for a descriptor the wrapping process passed
+func openEvents(target, runID string, now clock) (*eventWriter, error) {
+	var w io.WriteCloser
+	if strings.HasPrefix(target, "fd:") {
+		n, err := strconv.Atoi(strings.TrimPrefix(target, "fd:"))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("-events %q isn't fd:N", target)
+		}
+		w = os.NewFile(uintptr(n), target)
+	} else {
+		file, err := os.Create(target)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+	}
+	return &eventWriter{w: w, enc: json.NewEncoder(w), now: now, last: progressEvent{RunID: runID}}, nil
+}
+
+func (events *eventWriter) write(kind string) error {
+	events.last.Event = kind
+	events.last.Time = events.now.Now().UTC()
+	return events.enc.Encode(&events.last)
+}
+
+// Start writes the start event
+func (events *eventWriter) Start() error {
+	events.start = events.now.Now()
+	events.last.Version = eventsVersion
+	err := events.write(eventStart)
+	events.last.Version = ""
+	return err
+}
+
+// Record counts result and writes its progress event
+func (events *eventWriter) Record(result *DomainLookupResult) error {
+	events.last.Done++
+	switch result.Message {
+	case messageRegistered:
+		events.last.Registered++
+	case messageUnregistered:
+		events.last.Unregistered++
+	case messageReserved:
+		events.last.Reserved++
+	default:
+		events.last.Failed++
+	}
+	events.last.Domain = result.Domain
+	err := events.write(eventProgress)
+	events.last.Domain = ""
+	return err
+}
+
+// Finish writes the finish event and closes the target
+func (events *eventWriter) Finish() error {
+	events.last.ElapsedMS = events.now.Since(events.start).Milliseconds()
+	if err := events.write(eventFinish); err != nil {
+		events.w.Close()
+		return err
+	}
+	return events.w.Close()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// lookupTrace records what happened while querying a server for -explain
+type lookupTrace struct {
+	retries      int32
+	headFallback bool
+	mappedStatus bool
+}
+
+type traceKey struct{}
+
+// withTrace returns ctx carrying trace for requestRetry and queryRdap
+func withTrace(ctx context.Context, trace *lookupTrace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// traceOf returns the trace of ctx, nil without -explain
+func traceOf(ctx context.Context) *lookupTrace {
+	trace, _ := ctx.Value(traceKey{}).(*lookupTrace)
+	return trace
+}
+
+func (trace *lookupTrace) retried() {
+	if trace != nil {
+		atomic.AddInt32(&trace.retries, 1)
+	}
+}
+
+// explainResponse describes how the response of server, coded statusCode
+// after reading its error object, led to message
+func explainResponse(trace *lookupTrace, resp *http.Response, statusCode int, message string, result *RdapLookupResult) string {
+	parts := []string{fmt.Sprintf("%s %s answered %s", resp.Request.Method, resp.Request.URL.Redacted(), resp.Status)}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		parts[0] += " " + contentType
+	}
+	if trace.headFallback {
+		parts = append(parts, "HEAD unsupported, used GET")
+	}
+	if retries := atomic.LoadInt32(&trace.retries); retries > 0 {
+		parts = append(parts, fmt.Sprintf("after %d retries", retries))
+	}
+	if statusCode != resp.StatusCode {
+		parts = append(parts, fmt.Sprintf("its error object has code %d", statusCode))
+	}
+
+	switch {
+	case trace.mappedStatus:
+		parts = append(parts, fmt.Sprintf("-map-status classifies %d as %s", statusCode, message))
+	case message == messageRegistered:
+		parts = append(parts, "a 2xx answer means registered")
+	case message == messageReserved:
+		parts = append(parts, fmt.Sprintf("status %s marks it reserved", strings.Join(result.Status, ", ")))
+	case message == messageUnexpectedContentType:
+		parts = append(parts, "-strict-content-type requires an RDAP JSON content type")
+	case message == messageUnregistered:
+		parts = append(parts, "404 means not registered")
+	case message == messageUnauthorized:
+		parts = append(parts, "401 means the server wants credentials or refused them")
+	case message == messageForbidden:
+		parts = append(parts, "403 means the server refused the query or this IP")
+	case message == messageBadRequest:
+		parts = append(parts, "400 means the server rejected the query")
+	case message == messageRateLimited:
+		parts = append(parts, "429 means rate limited, retries ran out")
+	case message == messageServerError:
+		parts = append(parts, "5xx means the server failed")
+	default:
+		parts = append(parts, "the status code isn't one RDAP classifies")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// explainError describes a query of server failing with err
+func explainError(trace *lookupTrace, server string, err error) string {
+	explanation := fmt.Sprintf("query of %s failed: %v", redact(server), err)
+	if retries := atomic.LoadInt32(&trace.retries); retries > 0 {
+		explanation += fmt.Sprintf("; after %d retries", retries)
+	}
+	return explanation
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputField is a -fields column, its value nil when the result lacks it
+type outputField struct {
+	name  string
+	value func(result *DomainLookupResult) interface{}
+}
+
+// rdapValue returns get of the result's RDAP data, nil without any
+func rdapValue(get func(rdap *RdapLookupResult) interface{}) func(*DomainLookupResult) interface{} {
+	return func(result *DomainLookupResult) interface{} {
+		if result.Result == nil {
+			return nil
+		}
+		return get(result.Result)
+	}
+}
+
+// eventValue returns the date of the action event, nil when it has none
+func eventValue(action string) func(*DomainLookupResult) interface{} {
+	return func(result *DomainLookupResult) interface{} {
+		if date := result.eventDate(action); !date.IsZero() {
+			return date
+		}
+		return nil
+	}
+}
+
+// outputFields are the fields -fields can select, status being the message
+// like the -sort-by key
+var outputFields = []outputField{
+	{"domain", func(result *DomainLookupResult) interface{} { return result.Domain }},
+	{"tld", func(result *DomainLookupResult) interface{} { return result.TLD }},
+	{"status", func(result *DomainLookupResult) interface{} { return result.Message }},
+	{"server", rdapValue(func(rdap *RdapLookupResult) interface{} { return rdap.Server })},
+	{"registrar", rdapValue(func(rdap *RdapLookupResult) interface{} { return rdap.Registrar })},
+	{"registrar_id", rdapValue(func(rdap *RdapLookupResult) interface{} { return rdap.RegistrarID })},
+	{"reseller", rdapValue(func(rdap *RdapLookupResult) interface{} { return rdap.Reseller })},
+	{"rdap_status", rdapValue(func(rdap *RdapLookupResult) interface{} { return rdap.Status })},
+	{"nameservers", rdapValue(func(rdap *RdapLookupResult) interface{} {
+		var names []string
+		for _, ns := range rdap.Nameservers {
+			names = append(names, ns.Name)
+		}
+		return names
+	})},
+	{"port43", rdapValue(func(rdap *RdapLookupResult) interface{} { return rdap.Port43 })},
+	{"created", eventValue("registration")},
+	{"changed", eventValue("last changed")},
+	{"expires", eventValue("expiration")},
+	{"input", func(result *DomainLookupResult) interface{} { return result.Input }},
+	{"previous_message", func(result *DomainLookupResult) interface{} { return result.PreviousMessage }},
+	{"cached", func(result *DomainLookupResult) interface{} { return result.Cached }},
+	{"unreliable", func(result *DomainLookupResult) interface{} { return result.Unreliable }},
+	{"delegated", func(result *DomainLookupResult) interface{} {
+		if result.DNS == nil {
+			return nil
+		}
+		return result.DNS.Delegated
+	}},
+	{"explanation", func(result *DomainLookupResult) interface{} { return result.Explanation }},
+	{"run_id", func(result *DomainLookupResult) interface{} { return result.RunID }},
+}
+
+// parseFields returns the comma separated fields of list in order
+func parseFields(list string) ([]outputField, error) {
+	var fields []outputField
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, field := range outputFields {
+			if field.name == name {
+				fields = append(fields, field)
+				found = true
+				break
+			}
+		}
+		if !found {
+			names := make([]string, len(outputFields))
+			for i, field := range outputFields {
+				names[i] = field.name
+			}
+			return nil, fmt.Errorf("unknown -fields field %q, want %s", name, strings.Join(names, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// fieldString formats a field value for a CSV column
+func fieldString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case []string:
+		return strings.Join(value, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// fieldsJSON encodes the fields of result as a JSON object in their order
+func fieldsJSON(fields []outputField, result *DomainLookupResult) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.name)
+		value, err := json.Marshal(field.value(result))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import "sync"
+
+// flightCall is an in-flight or completed lookup
+type flightCall struct {
+	wg     sync.WaitGroup
+	result *DomainLookupResult
+}
+
+// flightGroup coalesces concurrent lookups of the same domain so that they
+// share a single RDAP request (singleflight pattern)
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do runs fn once for concurrent callers with the same key. Every caller gets
+// its own copy of the result, shared reports whether it came from another
+// caller's request
+func (g *flightGroup) Do(key string, fn func() *DomainLookupResult) (result *DomainLookupResult, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.result.clone(), true
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.result = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return call.result.clone(), false
+}
+
+// clone copies result and its RDAP details, slices of the details are shared
+func (result *DomainLookupResult) clone() *DomainLookupResult {
+	copied := *result
+	if result.Result != nil {
+		details := *result.Result
+		copied.Result = &details
+	}
+	return &copied
+}
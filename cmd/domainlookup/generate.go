@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// maxGenerated bounds how many domains a single pattern may expand to
+const maxGenerated = 1000000
+
+var (
+	regexNumericRange = regexp.MustCompile(`^(\d+)\.\.(\d+)$`)
+	regexLetterRange  = regexp.MustCompile(`^([a-z])\.\.([a-z])$`)
+)
+
+// expandPattern expands shell-like braces in pattern, e.g.
+// "brand.{com,net}" -> brand.com, brand.net and "word{1..3}.com" -> word1.com,
+// word2.com, word3.com. Braces may nest
+func expandPattern(pattern string) ([]string, error) {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		if strings.IndexByte(pattern, '}') >= 0 {
+			return nil, fmt.Errorf("unmatched } in pattern %q", pattern)
+		}
+		return []string{pattern}, nil
+	}
+
+	close, depth := -1, 0
+	for i := open; i < len(pattern) && close < 0; i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				close = i
+			}
+		}
+	}
+	if close < 0 {
+		return nil, fmt.Errorf("unmatched { in pattern %q", pattern)
+	}
+
+	prefix, body, suffix := pattern[:open], pattern[open+1:close], pattern[close+1:]
+	if strings.IndexByte(prefix, '}') >= 0 {
+		return nil, fmt.Errorf("unmatched } in pattern %q", pattern)
+	}
+
+	alternatives, err := braceAlternatives(body)
+	if err != nil {
+		return nil, err
+	}
+	suffixes, err := expandPattern(suffix)
+	if err != nil {
+		return nil, err
+	}
+	if len(alternatives)*len(suffixes) > maxGenerated {
+		return nil, fmt.Errorf("pattern %q expands to more than %d domains", pattern, maxGenerated)
+	}
+
+	var expanded []string
+	for _, alternative := range alternatives {
+		for _, s := range suffixes {
+			expanded = append(expanded, prefix+alternative+s)
+		}
+	}
+	return expanded, nil
+}
+
+// braceAlternatives expands the body of a {...} group, either a range like
+// 1..3 or a..c or comma separated alternatives
+func braceAlternatives(body string) ([]string, error) {
+	if m := regexNumericRange.FindStringSubmatch(body); m != nil {
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		if to < from {
+			from, to = to, from
+		}
+		if to-from >= maxGenerated {
+			return nil, fmt.Errorf("range {%s} is too large", body)
+		}
+		alternatives := make([]string, 0, to-from+1)
+		for i := from; i <= to; i++ {
+			alternatives = append(alternatives, strconv.Itoa(i))
+		}
+		return alternatives, nil
+	}
+	if m := regexLetterRange.FindStringSubmatch(body); m != nil {
+		from, to := m[1][0], m[2][0]
+		if to < from {
+			from, to = to, from
+		}
+		alternatives := make([]string, 0, to-from+1)
+		for c := from; c <= to; c++ {
+			alternatives = append(alternatives, string(c))
+		}
+		return alternatives, nil
+	}
+
+	// split on top level commas, nested groups expand recursively
+	var alternatives []string
+	depth, start := 0, 0
+	for i := 0; i <= len(body); i++ {
+		if i < len(body) {
+			switch body[i] {
+			case '{':
+				depth++
+				continue
+			case '}':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		expanded, err := expandPattern(body[start:i])
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, expanded...)
+		start = i + 1
+	}
+	if len(alternatives) == 0 {
+		return nil, errors.New("empty brace group")
+	}
+	return alternatives, nil
+}
+
+// validDomain reports whether domain is a host name of at least two labels
+// of letters, digits and inner hyphens under an alphabetic or xn-- TLD, once
+// converted to ASCII. Multi-label suffixes like co.uk and IDN TLDs pass
+func validDomain(domain string) bool {
+	name, err := idna.Lookup.ToASCII(domain)
+	if err != nil || len(name) > 253 {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if !validLabel(label) {
+			return false
+		}
+	}
+	tld := labels[len(labels)-1]
+	if strings.HasPrefix(tld, "xn--") {
+		return len(tld) > len("xn--")
+	}
+	if len(tld) < 2 {
+		return false
+	}
+	for i := 0; i < len(tld); i++ {
+		if tld[i] < 'a' || tld[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// validLabel reports whether label is 1 to 63 letters, digits and hyphens
+// not starting or ending with a hyphen
+func validLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// keywordDomains returns keyword under each of the comma separated tlds
+func keywordDomains(keyword, tlds string) []string {
+	var domains []string
+	for _, tld := range strings.Split(tlds, ",") {
+		tld = strings.TrimPrefix(strings.TrimSpace(tld), ".")
+		if tld != "" {
+			domains = append(domains, keyword+"."+tld)
+		}
+	}
+	return domains
+}
+
+// generateDomains expands patterns and the keyword/tlds pair into candidate
+// domains. Invalid candidates are dropped with a warning
+func generateDomains(patterns []string, keyword, tlds string) ([]string, error) {
+	var candidates []string
+	for _, pattern := range patterns {
+		expanded, err := expandPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, expanded...)
+	}
+	if keyword != "" {
+		if tlds == "" {
+			return nil, errors.New("-keyword requires -tlds")
+		}
+		candidates = append(candidates, keywordDomains(keyword, tlds)...)
+	}
+
+	domains := candidates[:0]
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(candidate)
+		if !validDomain(candidate) {
+			warnLog.Printf("skip invalid generated domain %q", candidate)
+			continue
+		}
+		domains = append(domains, candidate)
+	}
+	return domains, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"brand.com", true},
+		{"my-brand.io", true},
+		{"brand.co.uk", true},
+		{"brand.xn--p1ai", true},
+		{"пример.рф", true},
+		{"b.c", false},
+		{"brand", false},
+		{"-brand.com", false},
+		{"brand-.com", false},
+		{"br_and.com", false},
+		{"brand..com", false},
+		{"brand.c0m", false},
+		{"brand.xn--", false},
+		{strings.Repeat("a", 64) + ".com", false},
+	}
+	for _, tt := range tests {
+		if got := validDomain(tt.domain); got != tt.want {
+			t.Errorf("validDomain(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateDomains(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		keyword  string
+		tlds     string
+		want     []string
+	}{
+		{"tlds", []string{"brand.{com,net}"}, "", "", []string{"brand.com", "brand.net"}},
+		{"range", []string{"word{1..3}.com"}, "", "", []string{"word1.com", "word2.com", "word3.com"}},
+		{"multi label suffix", []string{"brand.{co.uk,com.au}"}, "", "", []string{"brand.co.uk", "brand.com.au"}},
+		{"idn tld", nil, "brand", "xn--p1ai,.io", []string{"brand.xn--p1ai", "brand.io"}},
+		{"invalid dropped", []string{"{-x,x}.com"}, "", "", []string{"x.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateDomains(tt.patterns, tt.keyword, tt.tlds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
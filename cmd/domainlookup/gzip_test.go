@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// gzipped compresses body
+func gzipped(t *testing.T, body string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(body))
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLookupServerGzip(t *testing.T) {
+	const body = `{"objectClassName":"domain","ldhName":"example.com","status":["active"]}`
+	tests := []struct {
+		name string
+		// the transport doesn't ask for gzip, the server compresses unasked
+		disableCompression bool
+		compress           bool
+	}{
+		{"asked and compressed", false, true},
+		{"unasked and compressed", true, true},
+		{"asked, plain", false, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/rdap+json")
+				if !tt.compress {
+					w.Write([]byte(body))
+					return
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(gzipped(t, body))
+			})
+			worker.client.Transport.(*http.Transport).DisableCompression = tt.disableCompression
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != messageRegistered {
+				t.Fatalf("message = %q, want %q", result.Message, messageRegistered)
+			}
+			if got := result.Result.Status; !reflect.DeepEqual(got, []string{"active"}) {
+				t.Errorf("status = %q, want the decompressed record's", got)
+			}
+		})
+	}
+}
+
+func TestLookupServerGzipMaxBody(t *testing.T) {
+	// compresses far below the limit, the limit applies to the decoded body
+	body := `"` + string(bytes.Repeat([]byte("x"), 4096)) + `"`
+	worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped(t, body))
+	})
+	worker.client.Transport.(*http.Transport).DisableCompression = true
+	worker.maxBody = 1024
+	result := worker.lookupServer(context.Background(), "example.com", "com", server)
+	if result.Message != messageResponseTooLarge {
+		t.Errorf("message = %q, want %q", result.Message, messageResponseTooLarge)
+	}
+}
+
+func TestRequestGzipWithoutBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+	}{
+		{"HEAD", http.MethodHead, http.StatusOK},
+		{"empty GET", http.MethodGet, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Header().Set("Content-Length", "0")
+				w.WriteHeader(tt.status)
+			})
+			worker.client.Transport.(*http.Transport).DisableCompression = true
+			worker.retries = 2
+			resp, body, err := worker.requestRetry(context.Background(), tt.method, server+"/domain/example.com")
+			if err != nil {
+				t.Fatalf("error %v, want the %d answered", err, tt.status)
+			}
+			if resp.StatusCode != tt.status || len(body) != 0 {
+				t.Errorf("got %d with %d bytes, want %d without body", resp.StatusCode, len(body), tt.status)
+			}
+		})
+	}
+}
+
+func TestLookupServerHeadGzip(t *testing.T) {
+	worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rdap+json")
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.Method != http.MethodHead {
+			w.Write(gzipped(t, `{}`))
+		}
+	})
+	worker.client.Transport.(*http.Transport).DisableCompression = true
+	worker.head = true
+	result := worker.lookupServer(context.Background(), "example.com", "com", server)
+	if result.Message != messageRegistered {
+		t.Errorf("message = %q, want %q", result.Message, messageRegistered)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// serverSet is a set of RDAP servers safe for concurrent use, the zero value
+// is empty
+type serverSet struct {
+	mu      sync.Mutex
+	servers map[string]bool
+}
+
+// add adds server, reporting whether it is new
+func (set *serverSet) add(server string) bool {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if set.servers == nil {
+		set.servers = make(map[string]bool)
+	}
+	if set.servers[server] {
+		return false
+	}
+	set.servers[server] = true
+	return true
+}
+
+func (set *serverSet) has(server string) bool {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return set.servers[server]
+}
+
+// fullRecordFlags returns the set flags needing the RDAP record -head
+// doesn't fetch
+func fullRecordFlags() []string {
+	var flags []string
+	for name, set := range map[string]bool{
+		"-thick":               fThick,
+		"-resolve-nameservers": fResolveNS,
+		"-deep":                fDeep,
+		"-registrar-id":        fRegistrarID != "",
+		"-registrar-match":     fRegistrarRe != "",
+		"-registrar-summary":   fRegistrars,
+		"-changed-since":       fChanged != "",
+		"-sort-by expiry":      fSortBy == sortByExpiry,
+		"-sqlite":              fSQLite != "",
+	} {
+		if set {
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
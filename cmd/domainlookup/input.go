@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// lookupInput is a domain to look up with the input it came with
+type lookupInput struct {
+	domain string
+
+	// other columns of the input line, carried into the result
+	extra []string
+
+	// position in the input
+	index int
+
+	// input host domain was reduced from by -apex
+	original string
+}
+
+// inputReader reads domains from a -f file
+type inputReader struct {
+	// 1 based CSV column holding the domain, 0 when the whole line is
+	column int
+
+	// keep the other columns of column input
+	passthrough bool
+
+	// longer lines are skipped, defaultMaxLine when 0
+	maxLine int
+
+	// look up the hosts of URL lines
+	fromURLs bool
+}
+
+// defaultMaxLine is the default max bytes of an input line
+const defaultMaxLine = 1 << 20
+
+// Read sends the domains of path, a file or an http(s) URL, in order
+func (reader *inputReader) Read(path string, send func(lookupInput)) error {
+	input, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	if reader.fromURLs {
+		next := send
+		send = func(input lookupInput) {
+			input.domain = urlHost(input.domain)
+			next(input)
+		}
+	}
+	if reader.column <= 0 {
+		return reader.readLines(input, send)
+	}
+	return reader.readColumns(input, send)
+}
+
+// urlHost returns the host of line when it parses as a URL, with or without
+// a scheme, dropping userinfo and port. Other lines are returned unchanged
+func urlHost(line string) string {
+	raw := strings.TrimSpace(line)
+	if !strings.Contains(raw, "://") && !strings.HasPrefix(raw, "//") {
+		if !strings.ContainsAny(raw, "/?#@:") {
+			return line
+		}
+		raw = "//" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return line
+	}
+	return u.Hostname()
+}
+
+// openInput opens the file or fetches the http(s) URL path. Fetches follow
+// redirects and use the proxy of the environment
+func openInput(path string) (io.ReadCloser, error) {
+	if !isURLInput(path) {
+		return os.Open(path)
+	}
+	resp, err := http.Get(path)
+	if err != nil {
+		return nil, fmt.Errorf("fetch input: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch input %s: %s", resp.Request.URL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// readLines reads a domain per line, skipping lines longer than maxLine with
+// a warning rather than failing the whole input
+func (reader *inputReader) readLines(r io.Reader, send func(lookupInput)) error {
+	maxLine := reader.maxLine
+	if maxLine <= 0 {
+		maxLine = defaultMaxLine
+	}
+	lines := bufio.NewReader(r)
+	var line []byte
+	for number := 1; ; number++ {
+		line = line[:0]
+		tooLong := false
+		for {
+			part, isPrefix, err := lines.ReadLine()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("line %d: %w", number, err)
+			}
+			if len(line)+len(part) > maxLine {
+				tooLong = true
+			}
+			if !tooLong {
+				line = append(line, part...)
+			}
+			if !isPrefix {
+				break
+			}
+		}
+		if tooLong {
+			warnLog.Printf("skip line %d longer than %d bytes", number, maxLine)
+			continue
+		}
+		send(lookupInput{domain: string(line)})
+	}
+}
+
+// readColumns reads CSV lines taking the domain from reader.column
+func (reader *inputReader) readColumns(r io.Reader, send func(lookupInput)) error {
+	records := csv.NewReader(r)
+	records.FieldsPerRecord = -1
+	records.LazyQuotes = true
+	records.TrimLeadingSpace = true
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) < reader.column {
+			line, _ := records.FieldPos(0)
+			warnLog.Printf("skip line %d without column %d", line, reader.column)
+			continue
+		}
+
+		input := lookupInput{domain: strings.TrimSpace(record[reader.column-1])}
+		if reader.passthrough {
+			input.extra = make([]string, 0, len(record)-1)
+			input.extra = append(input.extra, record[:reader.column-1]...)
+			input.extra = append(input.extra, record[reader.column:]...)
+		}
+		send(input)
+	}
+}
+
+// isURLInput reports whether the input path is an http(s) URL
+func isURLInput(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// validateInputFlags checks the input flags agree
+func validateInputFlags(column int, passthrough bool) error {
+	if column < 0 {
+		return fmt.Errorf("invalid column %d", column)
+	}
+	if passthrough && column == 0 {
+		return fmt.Errorf("-passthrough requires -column")
+	}
+	return nil
+}
+
+// cleanInput strips what pasted domains often carry around the name: the
+// leading // of a scheme relative URL, a trailing :port and the brackets of
+// an IPv6 literal like [2001:db8::1]:443. stripped names what was removed
+func cleanInput(domain string) (clean string, stripped []string) {
+	clean = strings.TrimSpace(domain)
+	if strings.HasPrefix(clean, "//") {
+		clean = clean[2:]
+		stripped = append(stripped, "leading //")
+	}
+	if strings.HasPrefix(clean, "[") {
+		end := strings.Index(clean, "]")
+		if end < 0 || clean[end+1:] != "" && !isPort(clean[end+1:]) {
+			return clean, stripped
+		}
+		stripped = append(stripped, "brackets")
+		if port := clean[end+1:]; port != "" {
+			stripped = append(stripped, "port "+port[1:])
+		}
+		return clean[1:end], stripped
+	}
+	// a single colon, more are an IPv6 address
+	if i := strings.LastIndex(clean, ":"); i > 0 && strings.Count(clean, ":") == 1 && isPort(clean[i:]) {
+		stripped = append(stripped, "port "+clean[i+1:])
+		clean = clean[:i]
+	}
+	return clean, stripped
+}
+
+// isPort reports whether s is a colon followed by a port number
+func isPort(s string) bool {
+	if len(s) < 2 || len(s) > 6 || s[0] != ':' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupName returns the name domain is looked up by: mapped by IDNA2008 for
+// lookup, which folds case and full-width forms, and converted to ASCII.
+// Names IDNA rejects are only lowercased
+func lookupName(domain string) string {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	name, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		verboseLog.Printf("normalize %q: %v", domain, err)
+		return strings.ToLower(domain)
+	}
+	return name
+}
+
+// lookupTLD returns the bootstrap key of a TLD given by the user, with or
+// without the leading dot, e.g. xn--p1ai for рф
+func lookupTLD(tld string) string {
+	return lookupName(strings.TrimPrefix(strings.TrimSpace(tld), "."))
+}
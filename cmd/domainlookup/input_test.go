@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookupName(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", "example.com"},
+		{"ExAmPle.COM", "example.com"},
+		{"EXAMPLE.COM.", "example.com"},
+		{" example.com ", "example.com"},
+		// full-width digits, letters and ideographic full stop
+		{"ｅｘａｍｐｌｅ１２３.com", "example123.com"},
+		{"shop１２３．ＣＯＭ", "shop123.com"},
+		{"example。com", "example.com"},
+		{"Bücher.de", "xn--bcher-kva.de"},
+		{"xn--bcher-kva.de", "xn--bcher-kva.de"},
+		// rejected by IDNA, only lowercased
+		{"Under_Score.COM", "under_score.com"},
+	}
+	for _, tt := range tests {
+		if got := lookupName(tt.domain); got != tt.want {
+			t.Errorf("lookupName(%q) = %q, want %q", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestReadLinesLong(t *testing.T) {
+	// longer than bufio.Scanner's 64KB default buffer
+	long := strings.Repeat("a", 100<<10) + ".com"
+	tests := []struct {
+		name    string
+		maxLine int
+		input   string
+		want    []string
+		warning string
+	}{
+		{"long line kept", 0, "a.com\n" + long + "\nb.com\n", []string{"a.com", long, "b.com"}, ""},
+		{"over max skipped", 1 << 10, "a.com\n" + long + "\nb.com", []string{"a.com", "b.com"}, "skip line 2 longer than 1024 bytes"},
+		{"last line over max", 1 << 10, "a.com\n" + long, []string{"a.com"}, "skip line 2"},
+		{"crlf", 0, "a.com\r\nb.com\r\n", []string{"a.com", "b.com"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warned := captureLog(t, warnLog)
+			reader := &inputReader{maxLine: tt.maxLine}
+			var got []string
+			err := reader.readLines(strings.NewReader(tt.input), func(input lookupInput) {
+				got = append(got, input.domain)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %d domains %.40q, want %d", len(got), got, len(tt.want))
+			}
+			if tt.warning != "" && !strings.Contains(warned.String(), tt.warning) {
+				t.Errorf("warnings %q, want %q", warned, tt.warning)
+			}
+		})
+	}
+}
+
+func TestLookupTLD(t *testing.T) {
+	tests := []struct {
+		tld  string
+		want string
+	}{
+		{"рф", "xn--p1ai"},
+		{".рф", "xn--p1ai"},
+		{"РФ", "xn--p1ai"},
+		{"xn--p1ai", "xn--p1ai"},
+		{"中国", "xn--fiqs8s"},
+		{" .COM ", "com"},
+	}
+	for _, tt := range tests {
+		if got := lookupTLD(tt.tld); got != tt.want {
+			t.Errorf("lookupTLD(%q) = %q, want %q", tt.tld, got, tt.want)
+		}
+	}
+	if got := topdomain(lookupName("пример.рф")); got != "xn--p1ai" {
+		t.Errorf("topdomain of пример.рф = %q, want xn--p1ai", got)
+	}
+}
+
+func TestLookupCyrillicDomain(t *testing.T) {
+	var path string
+	worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusNotFound)
+	})
+	limits, err := parseTLDLimits([]string{"рф=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := limits["xn--p1ai"]; !ok {
+		t.Errorf("-tld-concurrency рф=1 gives %v, want the limit on xn--p1ai", limits)
+	}
+	overrides, err := parseOverrides([]string{".рф=" + server})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.rdapLookupMap = overrides
+	result := worker.lookup(lookupName("Пример.РФ"))
+	if result.Message != messageUnregistered || result.TLD != "xn--p1ai" {
+		t.Errorf("got %q for TLD %q, want %q for xn--p1ai", result.Message, result.TLD, messageUnregistered)
+	}
+	if want := "/domain/xn--e1afmkfd.xn--p1ai"; path != want {
+		t.Errorf("queried %q, want %q", path, want)
+	}
+}
+
+func TestCleanInput(t *testing.T) {
+	tests := []struct {
+		domain       string
+		want         string
+		wantStripped []string
+	}{
+		{"example.com", "example.com", nil},
+		{" example.com ", "example.com", nil},
+		{"//example.com", "example.com", []string{"leading //"}},
+		{"example.com:443", "example.com", []string{"port 443"}},
+		{"//example.com:8080", "example.com", []string{"leading //", "port 8080"}},
+		{"[2001:db8::1]", "2001:db8::1", []string{"brackets"}},
+		{"[2001:db8::1]:443", "2001:db8::1", []string{"brackets", "port 443"}},
+		{"2001:db8::1", "2001:db8::1", nil},
+		{"[2001:db8::1]x", "[2001:db8::1]x", nil},
+		{"[2001:db8::1", "[2001:db8::1", nil},
+		{"example.com:http", "example.com:http", nil},
+		{"example.com:1234567", "example.com:1234567", nil},
+		{"example.com:", "example.com:", nil},
+	}
+	for _, tt := range tests {
+		got, stripped := cleanInput(tt.domain)
+		if got != tt.want || !reflect.DeepEqual(stripped, tt.wantStripped) {
+			t.Errorf("cleanInput(%q) = %q, %q, want %q, %q", tt.domain, got, stripped, tt.want, tt.wantStripped)
+		}
+	}
+}
+
+func TestCleanInputQueries(t *testing.T) {
+	queried := make(chan string, 10)
+	_, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		queried <- r.URL.Path
+		w.WriteHeader(http.StatusNotFound)
+	})
+	stdout, stderr, code := runMain(t, "-discovery", "override", "-override", "com="+server, "-d", "//Example.com:443")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	close(queried)
+	var paths []string
+	for path := range queried {
+		paths = append(paths, path)
+	}
+	if want := []string{"/domain/example.com"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("queried %q, want %q", paths, want)
+	}
+	if !strings.HasPrefix(stdout, "example.com,") {
+		t.Errorf("stdout %q, want the result of example.com", stdout)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// maxNameserverQueries bounds the concurrent nameserver queries of a domain
+const maxNameserverQueries = 4
+
+// queryNameservers looks up the RDAP nameserver objects of a registered
+// domain on its rdap server concurrently, filling in their details.
+// Queries share the request limits of the domain lookup but not its
+// concurrency slots: waiting for a slot while holding one could deadlock
+func (worker *LookupWorker) queryNameservers(ctx context.Context, rdap string, nameservers []Nameserver) {
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, maxNameserverQueries)
+	for i := range nameservers {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(ns *Nameserver) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			worker.queryNameserver(ctx, rdap, ns)
+		}(&nameservers[i])
+	}
+	wg.Wait()
+}
+
+func (worker *LookupWorker) queryNameserver(ctx context.Context, rdap string, ns *Nameserver) {
+	query, err := rdapObjectURL(rdap, "nameserver", ns.Name)
+	if err != nil {
+		verboseLog.Printf("nameserver %s: %v", ns.Name, err)
+		return
+	}
+	resp, body, err := worker.getRetry(ctx, query)
+	if err != nil {
+		verboseLog.Printf("nameserver %s: %v", query, err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		verboseLog.Printf("nameserver %s: %s", query, resp.Status)
+		return
+	}
+	object := &rdapNameserver{}
+	if err := json.Unmarshal(body, object); err != nil {
+		verboseLog.Printf("nameserver %s: %v", query, err)
+		return
+	}
+
+	resolved := object.nameserver()
+	if len(resolved.IPv4) > 0 {
+		ns.IPv4 = resolved.IPv4
+	}
+	if len(resolved.IPv6) > 0 {
+		ns.IPv6 = resolved.IPv6
+	}
+	if len(resolved.Status) > 0 {
+		ns.Status = resolved.Status
+	}
+	ns.Resolved = true
+}
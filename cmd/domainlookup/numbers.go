@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// -type object types
+const (
+	objectDomain = "domain"
+	objectIP     = "ip"
+	objectASN    = "asn"
+)
+
+// bootstraps of IP addresses and AS numbers, RFC 9224
+var numberBootstrapURLs = map[string][]string{
+	objectIP: {
+		"https://data.iana.org/rdap/ipv4.json",
+		"https://data.iana.org/rdap/ipv6.json",
+	},
+	objectASN: {
+		"https://data.iana.org/rdap/asn.json",
+	},
+}
+
+// numberBootstrap maps IP prefixes or AS number ranges to their RDAP servers
+type numberBootstrap struct {
+	objectType string
+	prefixes   []prefixServers
+	ranges     []asnRange
+}
+
+type prefixServers struct {
+	prefix  *net.IPNet
+	servers []string
+}
+
+type asnRange struct {
+	first, last uint64
+	servers     []string
+}
+
+// loadNumberBootstrap loads the bootstraps of objectType like the DNS one,
+// caching them next to cachePath. They have no embedded snapshot
+func loadNumberBootstrap(objectType string, template *bootstrapLoader) (*numberBootstrap, error) {
+	urls, ok := numberBootstrapURLs[objectType]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", objectType)
+	}
+	bootstrap := &numberBootstrap{objectType: objectType}
+	for _, url := range urls {
+		loader := *template
+		loader.dnsURL = url
+		loader.embedded = nil
+		if loader.cachePath != "" {
+			loader.cachePath = filepath.Join(filepath.Dir(loader.cachePath), path.Base(url))
+		}
+		dns, _, err := loader.Load()
+		if err != nil {
+			return nil, err
+		}
+		if err := bootstrap.add(dns); err != nil {
+			return nil, fmt.Errorf("rdap bootstrap %s: %w", url, err)
+		}
+	}
+	return bootstrap, nil
+}
+
+func (bootstrap *numberBootstrap) add(dns *RdapDNS) error {
+	for _, service := range dns.Services {
+		if len(service) != 2 {
+			return fmt.Errorf("service is not a tuple. service %+v", service)
+		}
+		servers := sortServers(service[1])
+		for _, entry := range service[0] {
+			if bootstrap.objectType == objectIP {
+				_, prefix, err := net.ParseCIDR(entry)
+				if err != nil {
+					return err
+				}
+				bootstrap.prefixes = append(bootstrap.prefixes, prefixServers{prefix: prefix, servers: servers})
+				continue
+			}
+			first, last, ok := strings.Cut(entry, "-")
+			if !ok {
+				last = first
+			}
+			r := asnRange{servers: servers}
+			var err error
+			if r.first, err = strconv.ParseUint(first, 10, 32); err != nil {
+				return err
+			}
+			if r.last, err = strconv.ParseUint(last, 10, 32); err != nil {
+				return err
+			}
+			bootstrap.ranges = append(bootstrap.ranges, r)
+		}
+	}
+	return nil
+}
+
+// errInvalidNumber is returned for names that aren't IPs or AS numbers
+var errInvalidNumber = errors.New("invalid number")
+
+// servers returns the query name of name, the address or the AS number
+// without the AS prefix, and its servers: of the longest covering prefix or
+// the covering AS range
+func (bootstrap *numberBootstrap) servers(name string) (string, []string, error) {
+	name = strings.TrimSpace(name)
+	if bootstrap.objectType == objectIP {
+		ip := net.ParseIP(name)
+		if ip == nil {
+			return name, nil, errInvalidNumber
+		}
+		var servers []string
+		longest := -1
+		for _, p := range bootstrap.prefixes {
+			if ones, _ := p.prefix.Mask.Size(); p.prefix.Contains(ip) && ones > longest {
+				servers, longest = p.servers, ones
+			}
+		}
+		return ip.String(), servers, nil
+	}
+
+	number, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(name), "AS"), 10, 32)
+	if err != nil {
+		return name, nil, errInvalidNumber
+	}
+	for _, r := range bootstrap.ranges {
+		if number >= r.first && number <= r.last {
+			return strconv.FormatUint(number, 10), r.servers, nil
+		}
+	}
+	return strconv.FormatUint(number, 10), nil, nil
+}
+
+// lookupNumber looks up an IP address or AS number of -type
+func (worker *LookupWorker) lookupNumber(ctx context.Context, name string) *DomainLookupResult {
+	query, apis, err := worker.numbers.servers(name)
+	if err != nil {
+		message := messageInvalidASN
+		if worker.numbers.objectType == objectIP {
+			message = messageInvalidIP
+		}
+		return &DomainLookupResult{Domain: name, Message: message}
+	}
+	if len(apis) == 0 {
+		return &DomainLookupResult{Domain: query, Message: messageNoServer}
+	}
+	if worker.consensus > 1 && len(apis) > 1 {
+		return worker.consensusLookup(ctx, query, "", apis)
+	}
+	return worker.lookupServer(ctx, query, "", apis[0])
+}
+
+// objectPath is the RDAP path segment of the objects looked up
+func (worker *LookupWorker) objectPath() string {
+	if worker.numbers == nil {
+		return "domain"
+	}
+	if worker.numbers.objectType == objectIP {
+		return "ip"
+	}
+	return "autnum"
+}
+
+// validateType checks objectType is known and the set flags apply to it
+func validateType(objectType string) error {
+	if objectType == objectDomain {
+		return nil
+	}
+	if _, ok := numberBootstrapURLs[objectType]; !ok {
+		return fmt.Errorf("unknown type %q, want domain, ip or asn", objectType)
+	}
+	for name, set := range map[string]bool{
+		"-apex":                fApex,
+		"-bootstrap-stats":     fBootstrapStats,
+		"-catch-all-check":     fCatchAll,
+		"-compare-whois":       fCompareWho,
+		"-deep":                fDeep,
+		"-dns-check":           fDNSCheck,
+		"-registrar-summary":   fRegistrars,
+		"-resolve-nameservers": fResolveNS,
+		"-thick":               fThick,
+		"-validate-only":       fValidate,
+		"-warmup":              fWarmup,
+	} {
+		if set {
+			return fmt.Errorf("%s only applies to -type domain", name)
+		}
+	}
+	return nil
+}
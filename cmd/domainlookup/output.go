@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// output formats
+const (
+	outputCSV  = "csv"
+	outputJSON = "json"
+	outputText = "text"
+	outputGob  = "gob"
+)
+
+// outputOptions tune the output formats
+type outputOptions struct {
+	// add the previous message of -diff-against
+	previous bool
+
+	// add the input host of -apex
+	input bool
+
+	// add the classification explanation of -explain
+	explain bool
+
+	// color the messages of text output
+	color bool
+
+	// columns of csv and keys of json output with -fields, nil for all
+	fields []outputField
+}
+
+// resultWriter writes lookup results to the output as they arrive
+type resultWriter interface {
+	Write(result *DomainLookupResult) error
+}
+
+// Encoder encodes a result to w in an output format. An encoder is made per
+// output, so it may keep state between results such as a gob stream's types
+type Encoder interface {
+	Encode(w io.Writer, result *DomainLookupResult) error
+}
+
+// encoders make the Encoder of each -o format
+var encoders = map[string]func(options outputOptions) Encoder{
+	outputCSV: func(options outputOptions) Encoder {
+		return &csvEncoder{previous: options.previous, input: options.input, explain: options.explain, fields: options.fields}
+	},
+	outputJSON: func(options outputOptions) Encoder { return jsonEncoder{fields: options.fields} },
+	outputText: func(options outputOptions) Encoder { return &textEncoder{options: options} },
+	outputGob:  func(outputOptions) Encoder { return &gobEncoder{} },
+}
+
+// registerEncoder adds format to -o, encoded by the encoders newEncoder
+// makes. It's for code added to this package, package main can't be
+// imported by embedders, and must be called from init, before -o is parsed
+func registerEncoder(format string, newEncoder func(options outputOptions) Encoder) {
+	if _, ok := encoders[format]; ok {
+		panic(fmt.Sprintf("output format %q registered twice", format))
+	}
+	encoders[format] = newEncoder
+}
+
+// newResultWriter returns a writer of format
+func newResultWriter(w io.Writer, format string, options outputOptions) (resultWriter, error) {
+	newEncoder, ok := encoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	if options.fields != nil && format != outputCSV && format != outputJSON {
+		return nil, errors.New("-fields applies to -o csv and json")
+	}
+	return &encoderWriter{w: w, enc: newEncoder(options)}, nil
+}
+
+// encoderWriter writes the results to w with enc
+type encoderWriter struct {
+	w   io.Writer
+	enc Encoder
+}
+
+func (writer *encoderWriter) Write(result *DomainLookupResult) error {
+	return writer.enc.Encode(writer.w, result)
+}
+
+// csvEncoder writes a domain,message,tld,server line per result, followed by
+// the input host with -apex, the previous message when diffing, the -explain
+// explanation and the passthrough columns. -fields replaces the columns
+// before the passthrough ones
+type csvEncoder struct {
+	previous bool
+	input    bool
+	explain  bool
+	fields   []outputField
+}
+
+func (enc *csvEncoder) Encode(w io.Writer, result *DomainLookupResult) error {
+	var record []string
+	if enc.fields != nil {
+		for _, field := range enc.fields {
+			record = append(record, fieldString(field.value(result)))
+		}
+		record = append(record, result.Extra...)
+		return writeCSV(w, record)
+	}
+
+	server := ""
+	if result.Result != nil {
+		server = result.Result.Server
+	}
+	record = []string{result.Domain, result.Message, result.TLD, server}
+	if enc.input {
+		record = append(record, result.Input)
+	}
+	if enc.previous {
+		record = append(record, result.PreviousMessage)
+	}
+	if enc.explain {
+		record = append(record, result.Explanation)
+	}
+	record = append(record, result.Extra...)
+	return writeCSV(w, record)
+}
+
+func writeCSV(w io.Writer, record []string) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(record); err != nil {
+		return err
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// jsonEncoder writes a JSON object per line per result, of only the -fields
+// keys in their order with fields
+type jsonEncoder struct {
+	fields []outputField
+}
+
+func (enc jsonEncoder) Encode(w io.Writer, result *DomainLookupResult) error {
+	if enc.fields == nil {
+		return json.NewEncoder(w).Encode(result)
+	}
+	data, err := fieldsJSON(enc.fields, result)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// gobEncoder writes the results as a gob stream of DomainLookupResult values,
+// for Go consumers decoding them with readGobResults or into a struct of the
+// fields they need
+type gobEncoder struct {
+	w   io.Writer
+	enc *gob.Encoder
+}
+
+func (enc *gobEncoder) Encode(w io.Writer, result *DomainLookupResult) error {
+	// the stream describes the type once, a new writer needs a new stream
+	if enc.enc == nil || enc.w != w {
+		enc.w, enc.enc = w, gob.NewEncoder(w)
+	}
+	return enc.enc.Encode(result)
+}
+
+// textEncoder writes a line of the domain and message per result for reading
+// in a terminal, followed by the previous message when diffing
+type textEncoder struct {
+	options outputOptions
+}
+
+// ANSI colors of text output
+const (
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+func (enc *textEncoder) Encode(w io.Writer, result *DomainLookupResult) error {
+	message := result.Message
+	if enc.options.color {
+		message = messageColor(result) + message + colorReset
+	}
+	line := fmt.Sprintf("%-30s %s", result.Domain, message)
+	if result.Input != "" && result.Input != result.Domain {
+		line += fmt.Sprintf(" (from %s)", result.Input)
+	}
+	if enc.options.previous && result.PreviousMessage != "" {
+		line += fmt.Sprintf(" (was %s)", result.PreviousMessage)
+	}
+	if result.Cached {
+		line += " (cached)"
+	}
+	if result.DNS != nil && !result.DNS.Delegated && result.DNS.Error == "" {
+		line += " (not delegated)"
+	}
+	if result.Unreliable {
+		line += " (unreliable, catch-all TLD)"
+	}
+	if result.Whois != nil && len(result.Whois.Mismatches) > 0 {
+		line += fmt.Sprintf(" (whois mismatch: %s)", strings.Join(result.Whois.Mismatches, ", "))
+	}
+	if enc.options.explain && result.Explanation != "" {
+		line += "\n    " + result.Explanation
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+// messageColor is red for taken, green for available and yellow for failed
+// domains
+func messageColor(result *DomainLookupResult) string {
+	switch {
+	case result.Message == messageUnregistered:
+		return colorGreen
+	case result.Failed():
+		return colorYellow
+	default:
+		return colorRed
+	}
+}
+
+// useColor reports whether text output to file is colored: when it's a
+// terminal, unless NO_COLOR is set or noColor
+func useColor(file *os.File, noColor bool) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(file)
+}
+
+// resultStore is a resultWriter keeping results somewhere that must be
+// closed at the end of the run
+type resultStore interface {
+	resultWriter
+	Close() error
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// parallelWriter formats results on several goroutines and writes them in
+// the order they were passed to Write, buffering the output while more
+// results are queued. Write only fails with the error of an earlier result,
+// Close returns the first error
+type parallelWriter struct {
+	jobs      chan formatJob
+	formatted chan formatJob
+	workers   sync.WaitGroup
+	done      chan struct{}
+	seq       int
+
+	mu  sync.Mutex
+	err error
+}
+
+// formatJob is a result to format and then its formatted output
+type formatJob struct {
+	seq    int
+	result *DomainLookupResult
+	data   []byte
+	err    error
+}
+
+// newParallelWriter returns a writer formatting results of format on
+// workers goroutines and writing them to w
+func newParallelWriter(w io.Writer, format string, options outputOptions, workers int) (resultStore, error) {
+	// validate the format before starting anything
+	if _, err := newResultWriter(io.Discard, format, options); err != nil {
+		return nil, err
+	}
+	if format == outputGob {
+		// a gob stream describes each type once, formatters on their own
+		// encoders would interleave type definitions
+		return nil, errors.New("-o gob can't be written by -write-workers")
+	}
+
+	writer := &parallelWriter{
+		jobs:      make(chan formatJob, 2*workers),
+		formatted: make(chan formatJob, 2*workers),
+		done:      make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		writer.workers.Add(1)
+		go writer.format(format, options)
+	}
+	go writer.write(w)
+	return writer, nil
+}
+
+func (writer *parallelWriter) format(format string, options outputOptions) {
+	defer writer.workers.Done()
+	buf := &bytes.Buffer{}
+	formatter, _ := newResultWriter(buf, format, options)
+	for job := range writer.jobs {
+		buf.Reset()
+		job.err = formatter.Write(job.result)
+		job.data = append([]byte(nil), buf.Bytes()...)
+		job.result = nil
+		writer.formatted <- job
+	}
+}
+
+// write writes the formatted results in sequence, flushing whenever it runs
+// out of formatted results
+func (writer *parallelWriter) write(w io.Writer) {
+	defer close(writer.done)
+	out := bufio.NewWriter(w)
+	pending := map[int]formatJob{}
+	next := 0
+	for job := range writer.formatted {
+		pending[job.seq] = job
+		for {
+			job, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if job.err == nil {
+				_, job.err = out.Write(job.data)
+			}
+			writer.fail(job.err)
+		}
+		if len(writer.formatted) == 0 {
+			writer.fail(out.Flush())
+		}
+	}
+	writer.fail(out.Flush())
+}
+
+func (writer *parallelWriter) fail(err error) {
+	if err == nil {
+		return
+	}
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if writer.err == nil {
+		writer.err = err
+	}
+}
+
+func (writer *parallelWriter) error() error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	return writer.err
+}
+
+func (writer *parallelWriter) Write(result *DomainLookupResult) error {
+	if err := writer.error(); err != nil {
+		return err
+	}
+	writer.jobs <- formatJob{seq: writer.seq, result: result}
+	writer.seq++
+	return nil
+}
+
+// Close writes the queued results
+func (writer *parallelWriter) Close() error {
+	close(writer.jobs)
+	writer.workers.Wait()
+	close(writer.formatted)
+	<-writer.done
+	return writer.error()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"text/template"
+)
+
+// outputTemplate is a format rendering a template per result, costly enough
+// for formatting to bound the writer's throughput
+const outputTemplate = "template"
+
+var resultTemplate = template.Must(template.New("result").Parse(
+	`{{range $i := .Rows}}{{$.Result.Domain | printf "%-40s"}} {{$.Result.Message | printf "%q"}} {{$.Result.TLD | html}} {{$i}}
+{{end}}`))
+
+type templateEncoder struct{}
+
+func (templateEncoder) Encode(w io.Writer, result *DomainLookupResult) error {
+	return resultTemplate.Execute(w, struct {
+		Result *DomainLookupResult
+		Rows   []int
+	}{result, make([]int, 20)})
+}
+
+func init() {
+	registerEncoder(outputTemplate, func(outputOptions) Encoder { return templateEncoder{} })
+}
+
+func testResults(n int) []*DomainLookupResult {
+	results := make([]*DomainLookupResult, n)
+	for i := range results {
+		results[i] = &DomainLookupResult{
+			Domain:  fmt.Sprintf("domain-%d.com", i),
+			TLD:     "com",
+			Message: messageRegistered,
+			Result:  &RdapLookupResult{Server: "https://rdap.example/", Status: []string{"active"}},
+		}
+	}
+	return results
+}
+
+func TestParallelWriterOrder(t *testing.T) {
+	results := testResults(500)
+	for _, format := range []string{outputCSV, outputJSON, outputText, outputTemplate} {
+		for _, workers := range []int{1, 3, 8} {
+			t.Run(fmt.Sprintf("%s/%d", format, workers), func(t *testing.T) {
+				want := &bytes.Buffer{}
+				serial, err := newResultWriter(want, format, outputOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := &bytes.Buffer{}
+				parallel, err := newParallelWriter(got, format, outputOptions{}, workers)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, result := range results {
+					serial.Write(result)
+					if err := parallel.Write(result); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := parallel.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got.Bytes(), want.Bytes()) {
+					t.Errorf("parallel output differs from the serial output")
+				}
+			})
+		}
+	}
+}
+
+func TestParallelWriterGob(t *testing.T) {
+	if _, err := newParallelWriter(io.Discard, outputGob, outputOptions{}, 2); err == nil {
+		t.Error("want -o gob refused")
+	}
+}
+
+// BenchmarkResultWriter compares writing results formatted on the consuming
+// goroutine with -write-workers, for a cheap and an expensive format
+func BenchmarkResultWriter(b *testing.B) {
+	results := testResults(1000)
+	for _, format := range []string{outputCSV, outputTemplate} {
+		b.Run(format+"/serial", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				writer, _ := newResultWriter(io.Discard, format, outputOptions{})
+				for _, result := range results {
+					writer.Write(result)
+				}
+			}
+		})
+		for _, workers := range []int{2, 4, 8} {
+			b.Run(fmt.Sprintf("%s/workers-%d", format, workers), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					writer, _ := newParallelWriter(io.Discard, format, outputOptions{}, workers)
+					for _, result := range results {
+						writer.Write(result)
+					}
+					writer.Close()
+				}
+			})
+		}
+	}
+}
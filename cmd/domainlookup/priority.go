@@ -0,0 +1,91 @@
+package main
+
+import (
+	"container/heap"
+	"strings"
+)
+
+// priorityItem is a queued domain, priority ones first then input order
+type priorityItem struct {
+	input    lookupInput
+	priority bool
+	seq      int
+}
+
+// priorityQueue implements heap.Interface
+type priorityQueue []priorityItem
+
+func (q priorityQueue) Len() int { return len(q) }
+
+func (q priorityQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q priorityQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *priorityQueue) Push(x interface{}) { *q = append(*q, x.(priorityItem)) }
+
+func (q *priorityQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// priorityPredicate returns whether a domain should be looked up first:
+// its name without the TLD is at most maxLen long or contains one of
+// keywords. It returns nil when no criterion is set
+func priorityPredicate(maxLen int, keywords []string) func(string) bool {
+	if maxLen <= 0 && len(keywords) == 0 {
+		return nil
+	}
+	return func(domain string) bool {
+		name := domain
+		if i := strings.LastIndexByte(domain, '.'); i >= 0 {
+			name = domain[:i]
+		}
+		if maxLen > 0 && len(name) <= maxLen {
+			return true
+		}
+		for _, keyword := range keywords {
+			if strings.Contains(name, keyword) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// prioritize forwards domains from in, handing out the ones matching
+// isPriority first. Pending domains are buffered in memory, so the whole
+// input may be held when it is read faster than looked up
+func prioritize(in <-chan lookupInput, isPriority func(string) bool) <-chan lookupInput {
+	out := make(chan lookupInput)
+	go func() {
+		defer close(out)
+		queue := &priorityQueue{}
+		seq := 0
+		for in != nil || queue.Len() > 0 {
+			var send chan<- lookupInput
+			var next lookupInput
+			if queue.Len() > 0 {
+				send, next = out, (*queue)[0].input
+			}
+			select {
+			case input, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				heap.Push(queue, priorityItem{input: input, priority: isPriority(input.domain), seq: seq})
+				seq++
+			case send <- next:
+				heap.Pop(queue)
+			}
+		}
+	}()
+	return out
+}
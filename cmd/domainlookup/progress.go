@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// progress redraw intervals
+const (
+	progressTTYInterval   = 200 * time.Millisecond
+	progressPlainInterval = 10 * time.Second
+
+	// time constant of the exponentially weighted completion rates
+	progressRateWindow = 30 * time.Second
+
+	// interval between -progress-file snapshots, whatever the redraws
+	progressFileInterval = time.Second
+)
+
+// progress reports how many results are done on a single line redrawn in
+// place on a terminal, or on a line per interval otherwise, and as a JSON
+// snapshot replacing file every progressFileInterval
+type progress struct {
+	out io.Writer
+	tty bool
+	now clock
+
+	// -progress-file path, "" for none
+	file string
+
+	mu           sync.Mutex
+	start        time.Time
+	done         int
+	registered   int
+	unregistered int
+	reserved     int
+	failed       int
+
+	// per TLD counts and completion rates for the ETA
+	tlds       map[string]*tldProgress
+	totalKnown bool
+	sampled    time.Time
+	rate       float64
+	last       int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// tldProgress counts the domains of a TLD
+type tldProgress struct {
+	total, queued, done int
+
+	// done at the last rate sample, rate in results per second
+	last int
+	rate float64
+}
+
+// isTerminal reports whether file is a character device like a terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressSnapshot is the state of the run written to -progress-file. Total
+// and ETA are null until known
+type progressSnapshot struct {
+	Processed    int      `json:"processed"`
+	Total        *int     `json:"total"`
+	Registered   int      `json:"registered"`
+	Unregistered int      `json:"unregistered"`
+	Reserved     int      `json:"reserved"`
+	Failed       int      `json:"failed"`
+	Rate         float64  `json:"rate"`
+	ElapsedS     float64  `json:"elapsed_s"`
+	ETAS         *float64 `json:"eta_s"`
+
+	Updated  time.Time `json:"updated"`
+	Finished bool      `json:"finished"`
+}
+
+// newProgress starts reporting to out, nil for none, and file until Stop
+func newProgress(out io.Writer, tty bool, file string, now clock) *progress {
+	p := &progress{
+		out:     out,
+		tty:     tty,
+		file:    file,
+		now:     now,
+		start:   now.Now(),
+		tlds:    make(map[string]*tldProgress),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	interval := progressPlainInterval
+	if tty {
+		interval = progressTTYInterval
+	}
+	p.sampled = p.start
+	go p.run(interval)
+	return p
+}
+
+func (p *progress) tld(tld string) *tldProgress {
+	t, ok := p.tlds[tld]
+	if !ok {
+		t = &tldProgress{}
+		p.tlds[tld] = t
+	}
+	return t
+}
+
+// SetTotals sets the expected number of domains per TLD, counted up front
+func (p *progress) SetTotals(totals map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for tld, total := range totals {
+		p.tld(tld).total = total
+	}
+	p.totalKnown = true
+}
+
+// Queue counts a domain of tld sent to lookup
+func (p *progress) Queue(tld string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tld(tld).queued++
+}
+
+// InputDone makes the queued domains the totals, after sampling or -apex
+// dropped some of the counted ones
+func (p *progress) InputDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.tlds {
+		t.total = t.queued
+	}
+	p.totalKnown = true
+}
+
+// run redraws the line every interval and writes the file on a ticker of its
+// own, so the 10s of plain output don't slow the file down
+func (p *progress) run(interval time.Duration) {
+	defer close(p.stopped)
+	var lines, files <-chan time.Time
+	if p.out != nil {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lines = ticker.C
+	}
+	if p.file != "" {
+		ticker := time.NewTicker(progressFileInterval)
+		defer ticker.Stop()
+		files = ticker.C
+	}
+	for {
+		select {
+		case <-lines:
+			p.draw(p.snapshot(false), false)
+		case <-files:
+			p.writeFile(p.snapshot(false))
+		case <-p.stop:
+			snapshot := p.snapshot(true)
+			p.writeFile(snapshot)
+			p.draw(snapshot, true)
+			return
+		}
+	}
+}
+
+// Record counts a result
+func (p *progress) Record(result *DomainLookupResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.tld(result.TLD).done++
+	switch result.Message {
+	case messageRegistered:
+		p.registered++
+	case messageUnregistered:
+		p.unregistered++
+	case messageReserved:
+		p.reserved++
+	default:
+		p.failed++
+	}
+}
+
+// Stop draws the final counts
+func (p *progress) Stop() {
+	close(p.stop)
+	<-p.stopped
+}
+
+// snapshot returns the current state, sampling the completion rates
+func (p *progress) snapshot(final bool) progressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now.Now()
+	elapsed := now.Sub(p.start)
+	snapshot := progressSnapshot{
+		Processed:    p.done,
+		Registered:   p.registered,
+		Unregistered: p.unregistered,
+		Reserved:     p.reserved,
+		Failed:       p.failed,
+		ElapsedS:     elapsed.Seconds(),
+		Updated:      now.UTC(),
+		Finished:     final,
+	}
+	if elapsed > 0 {
+		snapshot.Rate = float64(p.done) / elapsed.Seconds()
+	}
+	p.sample()
+	if p.totalKnown {
+		total := p.total()
+		snapshot.Total = &total
+	}
+	if eta, ok := p.eta(); ok && !final {
+		seconds := eta.Seconds()
+		snapshot.ETAS = &seconds
+	}
+	return snapshot
+}
+
+// writeFile writes snapshot to -progress-file when given
+func (p *progress) writeFile(snapshot progressSnapshot) {
+	if p.file == "" {
+		return
+	}
+	if err := writeProgressFile(p.file, snapshot); err != nil {
+		warnLog.Printf("-progress-file: %v", err)
+	}
+}
+
+// draw prints snapshot to out when given
+func (p *progress) draw(snapshot progressSnapshot, final bool) {
+	if p.out == nil {
+		return
+	}
+
+	done := fmt.Sprintf("%d done", snapshot.Processed)
+	if snapshot.Total != nil {
+		done = fmt.Sprintf("%d/%d done", snapshot.Processed, *snapshot.Total)
+	}
+	line := fmt.Sprintf("%s, %.1f/s, %d registered, %d unregistered, %d reserved, %d failed, %v",
+		done, snapshot.Rate, snapshot.Registered, snapshot.Unregistered, snapshot.Reserved, snapshot.Failed,
+		time.Duration(snapshot.ElapsedS*float64(time.Second)).Round(time.Second))
+	if snapshot.ETAS != nil {
+		line += fmt.Sprintf(", eta %v", time.Duration(*snapshot.ETAS*float64(time.Second)).Round(time.Second))
+	}
+
+	if p.tty {
+		// back to the line start and clear it
+		fmt.Fprintf(p.out, "\r\x1b[K%s", line)
+		if final {
+			fmt.Fprintln(p.out)
+		}
+		return
+	}
+	fmt.Fprintln(p.out, line)
+}
+
+// writeProgressFile replaces path with snapshot through a temporary file
+// renamed over it, so readers never see a partial snapshot
+func writeProgressFile(path string, snapshot progressSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (p *progress) total() int {
+	total := 0
+	for _, t := range p.tlds {
+		total += t.total
+	}
+	return total
+}
+
+// sample updates the completion rates with the results since the last
+// sample, weighting older samples down exponentially
+func (p *progress) sample() {
+	now := p.now.Now()
+	dt := now.Sub(p.sampled).Seconds()
+	if dt <= 0 {
+		return
+	}
+	p.sampled = now
+	alpha := 1 - math.Exp(-dt/progressRateWindow.Seconds())
+	p.rate = ewma(p.rate, float64(p.done-p.last)/dt, alpha, p.last == 0)
+	p.last = p.done
+	for _, t := range p.tlds {
+		t.rate = ewma(t.rate, float64(t.done-t.last)/dt, alpha, t.last == 0)
+		t.last = t.done
+	}
+}
+
+// ewma moves rate towards current by alpha, starting at current as long as
+// nothing was done before
+func ewma(rate, current, alpha float64, first bool) float64 {
+	if first {
+		return current
+	}
+	return rate + alpha*(current-rate)
+}
+
+// eta estimates the time remaining from the overall completion rate. TLDs
+// are looked up concurrently, so a slow TLD with many domains left determines
+// the end when it would still be running after the overall estimate
+func (p *progress) eta() (time.Duration, bool) {
+	if !p.totalKnown || p.rate <= 0 {
+		return 0, false
+	}
+	remaining := p.total() - p.done
+	if remaining <= 0 {
+		return 0, false
+	}
+	seconds := float64(remaining) / p.rate
+	for _, t := range p.tlds {
+		if left := t.total - t.done; left > 0 && t.rate > 0 && float64(left)/t.rate > seconds {
+			seconds = float64(left) / t.rate
+		}
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the progress goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProgressFileInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		out  bool
+		tty  bool
+	}{
+		{"plain output", true, false},
+		{"tty output", true, true},
+		{"no output", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/progress.json"
+			out := &syncBuffer{}
+			var p *progress
+			if tt.out {
+				p = newProgress(out, tt.tty, path, nil)
+			} else {
+				p = newProgress(nil, false, path, nil)
+			}
+			p.Record(&DomainLookupResult{TLD: "com", Message: messageRegistered})
+
+			// well before the 10s plain redraw
+			deadline := time.Now().Add(3 * progressFileInterval)
+			var snapshot progressSnapshot
+			for time.Now().Before(deadline) {
+				if data, err := os.ReadFile(path); err == nil {
+					if err := json.Unmarshal(data, &snapshot); err != nil {
+						t.Fatal(err)
+					}
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			if snapshot.Processed != 1 || snapshot.Registered != 1 || snapshot.Finished {
+				t.Errorf("snapshot %+v, want 1 registered, not finished", snapshot)
+			}
+			if !tt.tty && out.String() != "" {
+				t.Errorf("plain line drawn before its interval: %q", out)
+			}
+
+			p.Stop()
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &snapshot); err != nil || !snapshot.Finished {
+				t.Errorf("final snapshot %s, %v, want finished", data, err)
+			}
+			if tt.out && out.String() == "" {
+				t.Error("final line not drawn")
+			}
+		})
+	}
+}
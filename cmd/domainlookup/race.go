@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// raceLookup queries all of apis at once and returns the first conclusive
+// result, cancelling the requests still running. When every server fails
+// the first failure is returned
+func (worker *LookupWorker) raceLookup(ctx context.Context, domain, tld string, apis []string) *DomainLookupResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type answer struct {
+		server  string
+		result  *DomainLookupResult
+		elapsed time.Duration
+	}
+	answers := make(chan answer, len(apis))
+	start := worker.now.Now()
+	for _, server := range apis {
+		go func(server string) {
+			result := worker.lookupServer(ctx, domain, tld, server)
+			answers <- answer{server, result, worker.now.Since(start)}
+		}(server)
+	}
+
+	var failed *DomainLookupResult
+	for range apis {
+		answer := <-answers
+		if answer.result.Failed() {
+			if failed == nil {
+				failed = answer.result
+			}
+			continue
+		}
+		verboseLog.Printf("%s: %s answered first in %v", domain, redact(answer.server), answer.elapsed.Round(time.Millisecond))
+		if worker.explain {
+			answer.result.Explanation = fmt.Sprintf("fastest of %d raced servers; %s", len(apis), answer.result.Explanation)
+		}
+		return answer.result
+	}
+	return failed
+}
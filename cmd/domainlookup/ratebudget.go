@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rate limit headers, the X- ones and those of the IETF RateLimit draft
+var (
+	rateLimitHeaders     = []string{"X-RateLimit-Limit", "RateLimit-Limit"}
+	rateRemainingHeaders = []string{"X-RateLimit-Remaining", "RateLimit-Remaining"}
+	rateResetHeaders     = []string{"X-RateLimit-Reset", "RateLimit-Reset"}
+)
+
+// lowBudgetFraction of a server's limit left is logged with -verbose, or
+// lowBudgetRequests when it doesn't send its limit
+const (
+	lowBudgetFraction = 0.1
+	lowBudgetRequests = 5
+)
+
+// rateBudget is the request budget a server advertised last
+type rateBudget struct {
+	limit     int
+	remaining int
+	reset     time.Time
+
+	// whether the low budget was logged since the last reset
+	warned bool
+}
+
+// rateBudgets tracks the advertised budgets of servers by host
+type rateBudgets struct {
+	now clock
+
+	// wait for a server's reset once its budget is spent
+	throttle bool
+
+	mu      sync.Mutex
+	servers map[string]*rateBudget
+}
+
+func newRateBudgets(throttle bool, now clock) *rateBudgets {
+	return &rateBudgets{now: now, throttle: throttle, servers: make(map[string]*rateBudget)}
+}
+
+// headerInt returns the first of names header holds as an integer
+func headerInt(header http.Header, names []string) (int, bool) {
+	for _, name := range names {
+		// the draft allows a list of policies, the first is the current one
+		value, _, _ := strings.Cut(header.Get(name), ",")
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n >= 0 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// Observe records the budget advertised by the response of host
+func (budgets *rateBudgets) Observe(host string, header http.Header) {
+	remaining, ok := headerInt(header, rateRemainingHeaders)
+	if !ok {
+		return
+	}
+	now := budgets.now.Now()
+	limit, _ := headerInt(header, rateLimitHeaders)
+	var reset time.Time
+	if n, ok := headerInt(header, rateResetHeaders); ok {
+		// seconds from now, or a Unix time as GitHub style APIs send
+		if n > 1e9 {
+			reset = time.Unix(int64(n), 0)
+		} else {
+			reset = now.Add(time.Duration(n) * time.Second)
+		}
+	}
+
+	budgets.mu.Lock()
+	defer budgets.mu.Unlock()
+	budget, ok := budgets.servers[host]
+	if !ok {
+		budget = &rateBudget{}
+		budgets.servers[host] = budget
+	}
+	if remaining > budget.remaining {
+		// a new window
+		budget.warned = false
+	}
+	budget.limit, budget.remaining, budget.reset = limit, remaining, reset
+
+	low := remaining <= lowBudgetRequests
+	if limit > 0 {
+		low = float64(remaining) <= float64(limit)*lowBudgetFraction
+	}
+	if low && !budget.warned {
+		budget.warned = true
+		if reset.IsZero() {
+			verboseLog.Printf("%s rate limit budget low: %d of %d left", host, remaining, limit)
+		} else {
+			verboseLog.Printf("%s rate limit budget low: %d of %d left, resets in %v",
+				host, remaining, limit, reset.Sub(now).Round(time.Second))
+		}
+	}
+}
+
+// Wait blocks with throttling until host's budget resets when it is spent.
+// It doesn't wait past ctx's deadline, the request then goes out and
+// likely gets a 429 handled by the retries
+func (budgets *rateBudgets) Wait(ctx context.Context, host string) {
+	if !budgets.throttle {
+		return
+	}
+	budgets.mu.Lock()
+	budget, ok := budgets.servers[host]
+	var delay time.Duration
+	if ok && budget.remaining == 0 && !budget.reset.IsZero() {
+		delay = budgets.now.Until(budget.reset)
+	}
+	budgets.mu.Unlock()
+	if delay <= 0 {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok && budgets.now.Until(deadline) < delay {
+		return
+	}
+	verboseLog.Printf("%s rate limit budget spent, waiting %v", host, delay.Round(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
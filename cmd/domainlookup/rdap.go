@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rdapDomain is the subset of the RDAP domain object we use, see RFC 9083
+// section 5.3
+type rdapDomain struct {
+	ObjectClassName string           `json:"objectClassName"`
+	LDHName         string           `json:"ldhName"`
+	Status          []string         `json:"status"`
+	Entities        []rdapEntity     `json:"entities"`
+	Events          []rdapEvent      `json:"events"`
+	Links           []rdapLink       `json:"links"`
+	Remarks         []rdapRemark     `json:"remarks"`
+	Redacted        []rdapRedact     `json:"redacted"`
+	Nameservers     []rdapNameserver `json:"nameservers"`
+	Port43          string           `json:"port43"`
+}
+
+// rdapNameserver is an RDAP nameserver object, see RFC 9083 section 5.2
+type rdapNameserver struct {
+	LDHName     string   `json:"ldhName"`
+	Status      []string `json:"status"`
+	IPAddresses struct {
+		V4 []string `json:"v4"`
+		V6 []string `json:"v6"`
+	} `json:"ipAddresses"`
+}
+
+// Nameserver of a domain
+type Nameserver struct {
+	Name   string   `json:"name"`
+	IPv4   []string `json:"ipv4,omitempty"`
+	IPv6   []string `json:"ipv6,omitempty"`
+	Status []string `json:"status,omitempty"`
+
+	// set when the nameserver object was looked up with -resolve-nameservers
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+// nameserver returns the Nameserver of the object
+func (ns *rdapNameserver) nameserver() Nameserver {
+	return Nameserver{
+		Name:   strings.ToLower(strings.TrimSuffix(ns.LDHName, ".")),
+		IPv4:   ns.IPAddresses.V4,
+		IPv6:   ns.IPAddresses.V6,
+		Status: ns.Status,
+	}
+}
+
+// rdapRemark is an RDAP remark or notice, see RFC 9083 section 4.3
+type rdapRemark struct {
+	Title       string   `json:"title"`
+	Type        string   `json:"type"`
+	Description []string `json:"description"`
+}
+
+// rdapRedact is a redacted member, see RFC 9537 section 4.2
+type rdapRedact struct {
+	Name struct {
+		Type        string `json:"type"`
+		Description string `json:"description"`
+	} `json:"name"`
+}
+
+// rdapLink is an RDAP link, see RFC 9083 section 4.2
+type rdapLink struct {
+	Value string `json:"value"`
+	Rel   string `json:"rel"`
+	Href  string `json:"href"`
+	Type  string `json:"type"`
+}
+
+// rdapEvent is an RDAP event, see RFC 9083 section 4.5
+type rdapEvent struct {
+	EventAction string `json:"eventAction"`
+	EventActor  string `json:"eventActor"`
+	EventDate   string `json:"eventDate"`
+}
+
+// Event of the domain's history like registration or last changed
+type Event struct {
+	Action string    `json:"action"`
+	Date   time.Time `json:"date"`
+	Actor  string    `json:"actor,omitempty"`
+}
+
+// eventTimeline returns the events sorted by date, events without a valid
+// date are dropped
+func eventTimeline(events []rdapEvent) []Event {
+	var timeline []Event
+	for _, event := range events {
+		date, err := time.Parse(time.RFC3339, event.EventDate)
+		if err != nil {
+			verboseLog.Printf("skip rdap event %q with invalid date %q", event.EventAction, event.EventDate)
+			continue
+		}
+		timeline = append(timeline, Event{
+			Action: event.EventAction,
+			Date:   date,
+			Actor:  event.EventActor,
+		})
+	}
+	sortEvents(timeline)
+	return timeline
+}
+
+// sortEvents sorts events by date, keeping the order of same dated events
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(events[j].Date)
+	})
+}
+
+// rdapEntity is an RDAP entity object, see RFC 9083 section 5.1
+type rdapEntity struct {
+	Handle     string          `json:"handle"`
+	Roles      []string        `json:"roles"`
+	VcardArray json.RawMessage `json:"vcardArray"`
+	Remarks    []rdapRemark    `json:"remarks"`
+	PublicIDs  []rdapPublicID  `json:"publicIds"`
+	Entities   []rdapEntity    `json:"entities"`
+}
+
+// rdapPublicID is a public identifier of an entity, RFC 9083 section 4.8
+type rdapPublicID struct {
+	Type       string `json:"type"`
+	Identifier string `json:"identifier"`
+}
+
+// registrarIDType is the public ID type of IANA registrar IDs
+const registrarIDType = "IANA Registrar ID"
+
+// hasRole reports whether the entity plays role
+func (entity *rdapEntity) hasRole(role string) bool {
+	for _, r := range entity.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the formatted name (fn) of the entity's jCard, falling back
+// to its handle
+func (entity *rdapEntity) name() string {
+	// ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Name"]]]
+	var vcard []json.RawMessage
+	if err := json.Unmarshal(entity.VcardArray, &vcard); err == nil && len(vcard) == 2 {
+		var properties [][]json.RawMessage
+		if err := json.Unmarshal(vcard[1], &properties); err == nil {
+			for _, property := range properties {
+				var name, value string
+				if len(property) < 4 ||
+					json.Unmarshal(property[0], &name) != nil || name != "fn" ||
+					json.Unmarshal(property[3], &value) != nil {
+					continue
+				}
+				if value != "" {
+					return value
+				}
+			}
+		}
+	}
+	return entity.Handle
+}
+
+// findEntity returns the first entity with role, searching nested entities
+// after the top level ones
+func findEntity(entities []rdapEntity, role string) *rdapEntity {
+	for i := range entities {
+		if entities[i].hasRole(role) {
+			return &entities[i]
+		}
+	}
+	for i := range entities {
+		if entity := findEntity(entities[i].Entities, role); entity != nil {
+			return entity
+		}
+	}
+	return nil
+}
+
+// entityName returns the name of the entity with role, or "" if absent
+func entityName(entities []rdapEntity, role string) string {
+	if entity := findEntity(entities, role); entity != nil {
+		return entity.name()
+	}
+	return ""
+}
+
+// registrarID returns the IANA registrar ID of the registrar entity, or ""
+// if absent
+func registrarID(entities []rdapEntity) string {
+	entity := findEntity(entities, "registrar")
+	if entity == nil {
+		return ""
+	}
+	for _, id := range entity.PublicIDs {
+		if strings.EqualFold(id.Type, registrarIDType) {
+			return strings.TrimSpace(id.Identifier)
+		}
+	}
+	return ""
+}
+
+// RdapError is the error object of an unsuccessful RDAP response, RFC 9083
+// section 6
+type RdapError struct {
+	Code        int      `json:"code"`
+	Title       string   `json:"title,omitempty"`
+	Description []string `json:"description,omitempty"`
+}
+
+// rdapErrorObject is the wire form of RdapError
+type rdapErrorObject struct {
+	ErrorCode   int      `json:"errorCode"`
+	Title       string   `json:"title"`
+	Description []string `json:"description"`
+}
+
+// decodeRdapError returns the error object of a response body, nil when the
+// body isn't one
+func decodeRdapError(body []byte) *RdapError {
+	object := &rdapErrorObject{}
+	if err := json.Unmarshal(body, object); err != nil || object.ErrorCode == 0 {
+		return nil
+	}
+	return &RdapError{
+		Code:        object.ErrorCode,
+		Title:       object.Title,
+		Description: object.Description,
+	}
+}
+
+// decodeRdapDomain decodes an RDAP domain response body
+func decodeRdapDomain(body []byte) (*rdapDomain, error) {
+	domain := &rdapDomain{}
+	if err := json.Unmarshal(body, domain); err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
+
+// parseRdapDomain builds the lookup result from an RDAP domain response body
+func parseRdapDomain(body []byte) (*RdapLookupResult, error) {
+	domain, err := decodeRdapDomain(body)
+	if err != nil {
+		return nil, err
+	}
+	return domain.lookupResult(), nil
+}
+
+// lookupResult builds the lookup result of the domain object
+func (domain *rdapDomain) lookupResult() *RdapLookupResult {
+	result := &RdapLookupResult{
+		Status:    domain.Status,
+		Registrar: entityName(domain.Entities, "registrar"),
+		Reseller:  entityName(domain.Entities, "reseller"),
+		Events:    eventTimeline(domain.Events),
+
+		RegistrarID: registrarID(domain.Entities),
+
+		Nameservers: domain.nameservers(),
+
+		Port43: strings.TrimSpace(domain.Port43),
+
+		RedactedFields: domain.redactedFields(),
+	}
+	result.Redacted = len(result.RedactedFields) > 0 || domain.hasRedactionRemark()
+	return result
+}
+
+// nameservers returns the nameservers of the domain object
+func (domain *rdapDomain) nameservers() []Nameserver {
+	var nameservers []Nameserver
+	for i := range domain.Nameservers {
+		if ns := domain.Nameservers[i].nameserver(); ns.Name != "" {
+			nameservers = append(nameservers, ns)
+		}
+	}
+	return nameservers
+}
+
+// isRedactionRemark reports whether remark says data was withheld, e.g. the
+// RFC 9083 "object truncated due to authorization" type or the ICANN gTLD
+// profile's "REDACTED FOR PRIVACY" title
+func isRedactionRemark(remark rdapRemark) bool {
+	remarkType := strings.ToLower(remark.Type)
+	return strings.Contains(remarkType, "redacted") ||
+		strings.Contains(remarkType, "truncated due to authorization") ||
+		strings.Contains(strings.ToLower(remark.Title), "redacted")
+}
+
+// hasRedactionRemark reports whether any remark of the domain says data was
+// withheld
+func (domain *rdapDomain) hasRedactionRemark() bool {
+	for _, remark := range domain.Remarks {
+		if isRedactionRemark(remark) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedFields lists what the response withheld: the RFC 9537 redacted
+// names, then the roles of entities with a redaction remark
+func (domain *rdapDomain) redactedFields() []string {
+	var fields []string
+	seen := map[string]bool{}
+	add := func(field string) {
+		if field != "" && !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+
+	for _, redacted := range domain.Redacted {
+		if redacted.Name.Type != "" {
+			add(redacted.Name.Type)
+		} else {
+			add(redacted.Name.Description)
+		}
+	}
+
+	var walk func(entities []rdapEntity)
+	walk = func(entities []rdapEntity) {
+		for _, entity := range entities {
+			for _, remark := range entity.Remarks {
+				if isRedactionRemark(remark) {
+					for _, role := range entity.Roles {
+						add(role)
+					}
+					break
+				}
+			}
+			walk(entity.Entities)
+		}
+	}
+	walk(domain.Entities)
+	return fields
+}
+
+// reservedStatuses are the RDAP status values, lower case, marking a domain
+// as reserved by the registry rather than registered. -reserved-status adds
+// to them
+var reservedStatuses = map[string]bool{
+	"reserved":          true,
+	"registry reserved": true,
+}
+
+// isReserved reports whether any of statuses marks the domain as reserved
+func isReserved(statuses []string) bool {
+	for _, status := range statuses {
+		if reservedStatuses[strings.ToLower(strings.TrimSpace(status))] {
+			return true
+		}
+	}
+	return false
+}
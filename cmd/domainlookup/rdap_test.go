@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestLookupServerErrorObject(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantMessage string
+		wantError   *RdapError
+	}{
+		{
+			"400 with error object", http.StatusBadRequest,
+			`{"errorCode":400,"title":"Bad Request","description":["the domain label is too long"]}`,
+			messageBadRequest, &RdapError{Code: 400, Title: "Bad Request", Description: []string{"the domain label is too long"}},
+		},
+		{
+			"200 with not found error object", http.StatusOK,
+			`{"rdapConformance":["rdap_level_0"],"errorCode":404,"title":"Not Found"}`,
+			messageUnregistered, &RdapError{Code: 404, Title: "Not Found"},
+		},
+		{
+			"200 with rate limit error object", http.StatusOK,
+			`{"errorCode":429,"title":"Too Many Requests","description":["slow down"]}`,
+			messageRateLimited, &RdapError{Code: 429, Title: "Too Many Requests", Description: []string{"slow down"}},
+		},
+		{
+			"404 without body", http.StatusNotFound, "",
+			messageUnregistered, nil,
+		},
+		{
+			"domain object", http.StatusOK,
+			`{"objectClassName":"domain","ldhName":"example.com"}`,
+			messageRegistered, nil,
+		},
+		{
+			"200 with success code", http.StatusOK,
+			`{"objectClassName":"domain","errorCode":200}`,
+			messageRegistered, nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, serveRdap(tt.status, "application/rdap+json", tt.body))
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", result.Message, tt.wantMessage)
+			}
+			if result.Result == nil {
+				t.Fatal("no lookup result")
+			}
+			if !reflect.DeepEqual(result.Result.Error, tt.wantError) {
+				t.Errorf("error = %+v, want %+v", result.Result.Error, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errNoRecording is returned by -replay for requests that weren't recorded
+var errNoRecording = errors.New("no recording")
+
+// recording is a response saved by -record and served by -replay
+type recording struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// recordingPath is the file of the response to method and url in dir
+func recordingPath(dir, method, url string) string {
+	sum := sha256.Sum256([]byte(method + " " + url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:12])+".json")
+}
+
+// recordTransport saves every response of next to dir, failed requests
+// and responses over the body limit aren't recorded. Bodies are read with
+// the limit and stall guard of request(), which reads the saved copy
+type recordTransport struct {
+	next      http.RoundTripper
+	dir       string
+	maxBody   int64
+	readStall time.Duration
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = resp.Body
+	var guard *stallGuard
+	if t.readStall > 0 {
+		// closing the body ends a read stalled in it
+		guard = newStallGuard(resp.Body, t.readStall, func() { resp.Body.Close() })
+		r = guard
+	}
+	maxBody := t.maxBody
+	if maxBody <= 0 {
+		maxBody = defaultMaxBody
+	}
+	body, err := readBody(r, maxBody+1)
+	if guard != nil && guard.Stop() && err != nil {
+		err = errSlowResponse
+	}
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if int64(len(body)) > maxBody {
+		// request() fails it as too large, a recording would be cut short
+		return resp, nil
+	}
+
+	data, err := json.Marshal(&recording{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   body,
+	})
+	if err == nil {
+		err = os.WriteFile(recordingPath(t.dir, req.Method, req.URL.String()), data, 0o644)
+	}
+	if err != nil {
+		warnLog.Printf("WARNING: failed to record %s: %v", redact(req.URL.String()), err)
+	}
+	return resp, nil
+}
+
+// replayTransport serves the responses saved by -record in dir, matched by
+// method and URL, without any network request
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	data, err := os.ReadFile(recordingPath(t.dir, req.Method, req.URL.String()))
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w of %s %s", errNoRecording, req.Method, redact(req.URL.String()))
+	}
+	saved := &recording{}
+	if err := json.Unmarshal(data, saved); err != nil {
+		return nil, fmt.Errorf("recording of %s: %w", redact(req.URL.String()), err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", saved.Status, http.StatusText(saved.Status)),
+		StatusCode:    saved.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        saved.Header,
+		Body:          io.NopCloser(bytes.NewReader(saved.Body)),
+		ContentLength: int64(len(saved.Body)),
+		Request:       req,
+	}, nil
+}
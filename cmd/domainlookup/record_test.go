@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// recordingServer answers domain queries with benchDomainJSON and other
+// paths with 404
+func recordingServer(t *testing.T) (*http.Client, string) {
+	t.Helper()
+	worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", "Mon, 03 Jun 2024 12:00:00 GMT")
+		w.Header().Set("Content-Type", "application/rdap+json")
+		if r.URL.Path != "/domain/example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":404,"title":"Not Found"}`))
+			return
+		}
+		w.Write(benchDomainJSON)
+	})
+	return worker.client, server
+}
+
+// golden compares got with the file in testdata, rewriting it with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, got\n%s\nwant\n%s", path, got, want)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	live, server := recordingServer(t)
+	dir := t.TempDir()
+	recorder := &LookupWorker{client: &http.Client{Transport: &recordTransport{next: live.Transport, dir: dir}}}
+	replayer := &LookupWorker{client: &http.Client{Transport: &replayTransport{dir: dir}}}
+
+	tests := []struct {
+		domain string
+		want   string
+		file   string
+	}{
+		{"example.com", messageRegistered, "record-registered.golden"},
+		{"free.com", messageUnregistered, "record-unregistered.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			recorded := recorder.lookupServer(context.Background(), tt.domain, "com", server)
+			if recorded.Message != tt.want {
+				t.Fatalf("recorded %q, want %q", recorded.Message, tt.want)
+			}
+			data, err := os.ReadFile(recordingPath(dir, http.MethodGet, server+"/domain/"+tt.domain))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the port of the test server changes between runs
+			golden(t, tt.file, bytes.ReplaceAll(data, []byte(server), []byte("http://rdap.test")))
+
+			replayed := replayer.lookupServer(context.Background(), tt.domain, "com", server)
+			if replayed.Message != recorded.Message {
+				t.Errorf("replayed %q, recorded %q", replayed.Message, recorded.Message)
+			}
+			if (recorded.Result == nil) != (replayed.Result == nil) ||
+				(recorded.Result != nil && strings.Join(recorded.Result.Status, ",") != strings.Join(replayed.Result.Status, ",")) {
+				t.Errorf("replayed result %+v, recorded %+v", replayed.Result, recorded.Result)
+			}
+		})
+	}
+
+	result := replayer.lookupServer(context.Background(), "unknown.com", "com", server)
+	if result.Message != messageNoRecording {
+		t.Errorf("unrecorded query got %q, want %q", result.Message, messageNoRecording)
+	}
+}
+
+func TestRecordLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{"over -max-body", serveRdap(http.StatusOK, "application/rdap+json", `"`+strings.Repeat("x", 4096)+`"`), messageResponseTooLarge},
+		{"stalled body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/rdap+json")
+			w.Write([]byte(`{"objectClassName":`))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}, messageSlowResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live, server := newTestServer(t, tt.handler)
+			dir := t.TempDir()
+			worker := &LookupWorker{
+				client: &http.Client{Transport: &recordTransport{
+					next:      live.client.Transport,
+					dir:       dir,
+					maxBody:   1024,
+					readStall: 100 * time.Millisecond,
+				}},
+				maxBody:   1024,
+				readStall: 100 * time.Millisecond,
+			}
+			start := time.Now()
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("took %v", elapsed)
+			}
+			if files, _ := os.ReadDir(dir); len(files) != 0 {
+				t.Errorf("recorded %d responses, want none", len(files))
+			}
+		})
+	}
+}
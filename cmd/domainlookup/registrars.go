@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// unknownRegistrar groups registered domains without a registrar name
+const unknownRegistrar = "unknown"
+
+// registrarSummary counts registered domains per registrar
+type registrarSummary struct {
+	counts map[string]int
+	total  int
+}
+
+func newRegistrarSummary() *registrarSummary {
+	return &registrarSummary{counts: make(map[string]int)}
+}
+
+// Add counts result when it's registered
+func (summary *registrarSummary) Add(result *DomainLookupResult) {
+	if result.Message != messageRegistered {
+		return
+	}
+	registrar := unknownRegistrar
+	if result.Result != nil && result.Result.Registrar != "" {
+		registrar = result.Result.Registrar
+	}
+	summary.counts[registrar]++
+	summary.total++
+}
+
+// Print writes a count per registrar, most domains first
+func (summary *registrarSummary) Print(w io.Writer) error {
+	registrars := make([]string, 0, len(summary.counts))
+	for registrar := range summary.counts {
+		registrars = append(registrars, registrar)
+	}
+	sort.Slice(registrars, func(i, j int) bool {
+		a, b := summary.counts[registrars[i]], summary.counts[registrars[j]]
+		if a != b {
+			return a > b
+		}
+		return registrars[i] < registrars[j]
+	})
+
+	if _, err := fmt.Fprintf(w, "registered domains: %d\n", summary.total); err != nil {
+		return err
+	}
+	for _, registrar := range registrars {
+		if _, err := fmt.Fprintf(w, "%7d %s\n", summary.counts[registrar], registrar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
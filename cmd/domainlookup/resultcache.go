@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultResultTTL is how long -result-cache serves a cached result
+const defaultResultTTL = time.Hour
+
+// resultCache keeps the conclusive result of a domain in a JSON file per
+// domain, fresh while the file is younger than ttl like the bootstrap cache
+type resultCache struct {
+	dir string
+	ttl time.Duration
+	now clock
+
+	warn sync.Once
+}
+
+func newResultCache(dir string, ttl time.Duration) (*resultCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &resultCache{dir: dir, ttl: ttl}, nil
+}
+
+// path is the cache file of name, empty for names unfit for a file name
+func (cache *resultCache) path(name string) string {
+	if name == "" || strings.HasPrefix(name, ".") {
+		return ""
+	}
+	return filepath.Join(cache.dir, url.PathEscape(name)+".json")
+}
+
+// Get returns the fresh cached result of name, marked as cached
+func (cache *resultCache) Get(name string) (*DomainLookupResult, bool) {
+	path := cache.path(name)
+	if path == "" {
+		return nil, false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || cache.ttl > 0 && cache.now.Since(info.ModTime()) > cache.ttl {
+		return nil, false
+	}
+	result := &DomainLookupResult{}
+	if err := json.NewDecoder(file).Decode(result); err != nil {
+		return nil, false
+	}
+	result.Cached = true
+	return result, true
+}
+
+// Put caches result of name unless the lookup failed. Failing writes are
+// warned about once, the run goes on uncached
+func (cache *resultCache) Put(name string, result *DomainLookupResult) {
+	path := cache.path(name)
+	if path == "" || result.Failed() {
+		return
+	}
+	if err := cache.write(path, result); err != nil {
+		cache.warn.Do(func() {
+			warnLog.Printf("WARNING: failed to write the result cache: %v", err)
+		})
+	}
+}
+
+// write atomically replaces the file at path with result
+func (cache *resultCache) write(path string, result *DomainLookupResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(cache.dir, ".result.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Failed reports whether the lookup errored or timed out instead of
+// determining the registration status
+func (result *DomainLookupResult) Failed() bool {
+	switch result.Message {
+	case messageRegistered, messageUnregistered, messageReserved:
+		return false
+	default:
+		return true
+	}
+}
+
+// readResults reads the results of a previous run written as CSV or JSON,
+// or as gob when path ends in .gob
+func readResults(path string) (results []*DomainLookupResult, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(path, ".gob") {
+		results, err = readGobResults(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return results, nil
+	}
+
+	reader := bufio.NewReader(file)
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if first == '{' {
+		dec := json.NewDecoder(reader)
+		for {
+			result := &DomainLookupResult{}
+			if err := dec.Decode(result); err == io.EOF {
+				return results, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			results = append(results, result)
+		}
+	}
+
+	r := csv.NewReader(reader)
+	r.FieldsPerRecord = -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%s: expected domain,message got %q", path, record)
+		}
+		result := &DomainLookupResult{Domain: record[0], Message: record[1]}
+		if len(record) > 2 {
+			result.TLD = record[2]
+		}
+		results = append(results, result)
+	}
+}
+
+// readGobResults decodes the results of -o gob from r
+func readGobResults(r io.Reader) (results []*DomainLookupResult, err error) {
+	dec := gob.NewDecoder(r)
+	for {
+		result := &DomainLookupResult{}
+		if err := dec.Decode(result); err == io.EOF {
+			return results, nil
+		} else if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+}
+
+// peekNonSpace skips leading white space and returns the next byte unread
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, reader.UnreadByte()
+	}
+}
+
+// failedDomains returns the domains of a previous run that failed
+func failedDomains(path string) ([]string, error) {
+	results, err := readResults(path)
+	if err != nil {
+		return nil, err
+	}
+	var domains []string
+	for _, result := range results {
+		if result.Failed() {
+			domains = append(domains, result.Domain)
+		}
+	}
+	if len(results) > 0 && len(domains) == 0 {
+		warnLog.Printf("no failed domains in %s", path)
+	}
+	return domains, nil
+}
+
+// normalizeDomain returns the name domains are matched by across runs
+func normalizeDomain(domain string) string {
+	return lookupName(domain)
+}
+
+// previousMessages maps the normalized domains of a previous run to their
+// message
+func previousMessages(path string) (map[string]string, error) {
+	results, err := readResults(path)
+	if err != nil {
+		return nil, err
+	}
+	messages := make(map[string]string, len(results))
+	for _, result := range results {
+		messages[normalizeDomain(result.Domain)] = result.Message
+	}
+	return messages, nil
+}
+
+// changed reports whether result differs from the previous run, recording
+// the previous message on it. Domains new since the previous run changed
+func changed(previous map[string]string, result *DomainLookupResult) bool {
+	message, ok := previous[normalizeDomain(result.Domain)]
+	if ok && message == result.Message {
+		return false
+	}
+	result.PreviousMessage = message
+	return true
+}
+
+// hasRegistrarID reports whether the domain is registered at the registrar
+// with the IANA id
+func (result *DomainLookupResult) hasRegistrarID(id string) bool {
+	return result.Message == messageRegistered && result.Result != nil &&
+		result.Result.RegistrarID == strings.TrimSpace(id)
+}
+
+// registrarMatches reports whether the domain is registered at a registrar
+// whose name matches re
+func (result *DomainLookupResult) registrarMatches(re *regexp.Regexp) bool {
+	return result.Message == messageRegistered && result.Result != nil &&
+		result.Result.Registrar != "" && re.MatchString(result.Result.Registrar)
+}
+
+// nameLength is the length in characters of the domain without its TLD,
+// counted in Unicode for internationalized names
+func (result *DomainLookupResult) nameLength() int {
+	name := result.Domain
+	if unicode, err := idna.ToUnicode(name); err == nil {
+		name = unicode
+	}
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	return utf8.RuneCountInString(name)
+}
+
+// eventDate returns the date of the first event with action, zero when the
+// result has none
+func (result *DomainLookupResult) eventDate(action string) time.Time {
+	if result.Result == nil {
+		return time.Time{}
+	}
+	for _, event := range result.Result.Events {
+		if event.Action == action {
+			return event.Date
+		}
+	}
+	return time.Time{}
+}
+
+// changedSince reports whether the last changed event of the result is on or
+// after since
+func (result *DomainLookupResult) changedSince(since time.Time) bool {
+	changed := result.eventDate("last changed")
+	return !changed.IsZero() && !changed.Before(since)
+}
+
+// parseDate parses an RFC 3339 time or a 2006-01-02 date in UTC
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, want RFC 3339 or 2006-01-02", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetries = 2
+	defaultTimeout = 30 * time.Second
+
+	// backoff when a 429 has no usable Retry-After and of connection resets
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// retryDelay is how long to wait before retrying attempt (0 based) after a
+// 429, honoring Retry-After in seconds or as an HTTP date
+func retryDelay(retryAfter string, attempt int, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// isConnectionReset reports whether err is the server closing or resetting
+// the connection before the response was complete. A bare io.EOF, like
+// reading an empty body, isn't one, only the transport failing with EOF
+// on a connection closed before the response
+func isConnectionReset(err error) bool {
+	var urlErr *url.Error
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		(errors.As(err, &urlErr) && urlErr.Err == io.EOF)
+}
+
+// getRetry GETs query with retries, see requestRetry
+func (worker *LookupWorker) getRetry(ctx context.Context, query string) (resp *http.Response, body []byte, err error) {
+	return worker.requestRetry(ctx, http.MethodGet, query)
+}
+
+// requestRetry requests query and retries rate limited (429) responses and
+// connection resets up to worker.retries times. Bodies are fully read so
+// retries reuse the keep-alive connection, and no retry is attempted that
+// would wait past ctx's deadline, the last response or error is returned
+// instead
+func (worker *LookupWorker) requestRetry(ctx context.Context, method, query string) (resp *http.Response, body []byte, err error) {
+	for attempt := 0; ; attempt++ {
+		resp, body, err = worker.request(ctx, method, query)
+		if attempt >= worker.retries {
+			return
+		}
+		var delay time.Duration
+		switch {
+		case err != nil && isConnectionReset(err):
+			verboseLog.Printf("retry %s after connection reset: %v", redact(query), err)
+			delay = retryDelay("", attempt, worker.now.Now())
+		case err == nil && resp.StatusCode == http.StatusTooManyRequests:
+			delay = retryDelay(resp.Header.Get("Retry-After"), attempt, worker.now.Now())
+		default:
+			return
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && worker.now.Until(deadline) < delay {
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		traceOf(ctx).retried()
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"seconds", "7", 0, 7 * time.Second},
+		{"http date", now.Add(90 * time.Second).Format(http.TimeFormat), 0, 90 * time.Second},
+		{"past date", now.Add(-time.Minute).Format(http.TimeFormat), 0, 0},
+		{"backoff first", "", 0, retryBaseDelay},
+		{"backoff third", "", 2, 4 * retryBaseDelay},
+		{"backoff capped", "", 10, retryMaxDelay},
+		{"garbage", "soon", 1, 2 * retryBaseDelay},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.retryAfter, tt.attempt, now); got != tt.want {
+			t.Errorf("%s: retryDelay(%q, %d) = %v, want %v", tt.name, tt.retryAfter, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// countingServer answers with handler and counts the requests and the
+// connections they came on
+func countingServer(t *testing.T, handler http.HandlerFunc) (worker *LookupWorker, url string, requests, conns *int32) {
+	t.Helper()
+	requests, conns = new(int32), new(int32)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		handler(w, r)
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(conns, 1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return &LookupWorker{client: srv.Client()}, srv.URL, requests, conns
+}
+
+func TestRequestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		retries    int
+		timeout    time.Duration
+		// answer 200 from this request on, 0 never
+		okFrom       int32
+		wantStatus   int
+		wantRequests int32
+		maxElapsed   time.Duration
+	}{
+		{"succeeds after retries", "0", 3, 0, 3, http.StatusOK, 3, time.Second},
+		{"retries run out", "0", 2, 0, 0, http.StatusTooManyRequests, 3, time.Second},
+		{"no retries", "0", 0, 0, 0, http.StatusTooManyRequests, 1, time.Second},
+		// waiting 5s would pass the deadline, so the 429 is returned at once
+		{"deadline bounds retries", "5", 3, 500 * time.Millisecond, 0, http.StatusTooManyRequests, 1, 400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var served int32
+			worker, url, requests, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if n := atomic.AddInt32(&served, 1); tt.okFrom > 0 && n >= tt.okFrom {
+					w.Write([]byte(`{}`))
+					return
+				}
+				w.Header().Set("Retry-After", tt.retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"errorCode":429}`))
+			})
+			worker.retries = tt.retries
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			resp, _, err := worker.getRetry(ctx, url+"/domain/example.com")
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := atomic.LoadInt32(requests); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if got := atomic.LoadInt32(conns); got != 1 {
+				t.Errorf("connections = %d, want retries to reuse 1", got)
+			}
+			if elapsed > tt.maxElapsed {
+				t.Errorf("took %v, want at most %v", elapsed, tt.maxElapsed)
+			}
+		})
+	}
+}
+
+func TestConnectionReset(t *testing.T) {
+	tests := []struct {
+		name string
+		// drop the connection of the first requests, answer 404 after
+		drops     int32
+		midBody   bool
+		retries   int
+		want      string
+		wantTries int32
+	}{
+		{"before the response", 1, false, 0, messageConnectionReset, 1},
+		{"mid body", 1, true, 0, messageConnectionReset, 1},
+		// each retry backs off retryBaseDelay or more
+		{"retried", 1, true, 1, messageUnregistered, 2},
+		{"retries run out", 5, false, 1, messageConnectionReset, 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var served int32
+			worker, url, requests, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&served, 1) > tt.drops {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if tt.midBody {
+					buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/rdap+json\r\nContent-Length: 1000\r\n\r\n{\"objectClass")
+					buf.Flush()
+				}
+				conn.Close()
+			})
+			worker.retries = tt.retries
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			result := worker.lookupServer(ctx, "example.com", "com", url)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+			if got := atomic.LoadInt32(requests); got != tt.wantTries {
+				t.Errorf("requests = %d, want %d", got, tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestIsConnectionReset(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"cut body", io.ErrUnexpectedEOF, true},
+		{"closed before the response", &url.Error{Op: "Get", URL: "https://rdap.example/", Err: io.EOF}, true},
+		{"bare EOF", io.EOF, false},
+		{"wrapped EOF", fmt.Errorf("gzip: %w", io.EOF), false},
+		{"timeout", context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := isConnectionReset(tt.err); got != tt.want {
+			t.Errorf("%s: isConnectionReset(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
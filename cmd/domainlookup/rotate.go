@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// rotatedSuffix is the timestamp layout appended to rotated -out files
+const rotatedSuffix = "20060102T150405Z"
+
+// rotatingFile appends to the file at path and moves it aside with a
+// timestamp suffix once it's larger than size bytes or older than interval,
+// 0 disabling either. It only rotates after a write ending a line, so a
+// result is never split across files
+type rotatingFile struct {
+	path     string
+	size     int64
+	interval time.Duration
+	now      clock
+
+	file    *os.File
+	written int64
+	opened  time.Time
+	newline bool
+}
+
+func openRotatingFile(path string, size int64, interval time.Duration, now clock) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, size: size, interval: interval, now: now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.written, f.opened = file, info.Size(), f.now.Now()
+	// an existing file may end mid line, appending completes it first
+	f.newline = true
+	if f.written > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, f.written-1); err != nil {
+			file.Close()
+			return err
+		}
+		f.newline = last[0] == '\n'
+	}
+	return nil
+}
+
+func (f *rotatingFile) due() bool {
+	if !f.newline || f.written == 0 {
+		return false
+	}
+	return f.size > 0 && f.written >= f.size ||
+		f.interval > 0 && f.now.Since(f.opened) >= f.interval
+}
+
+// rotate renames the current file with the time as suffix, numbered when
+// that name is taken, and opens a new one
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	base := f.path + "." + f.now.Now().UTC().Format(rotatedSuffix)
+	name := base
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+	if err := os.Rename(f.path, name); err != nil {
+		return err
+	}
+	verboseLog.Printf("rotated %s to %s", f.path, name)
+	return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.due() {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.written += int64(n)
+	if n > 0 {
+		f.newline = p[n-1] == '\n'
+	}
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
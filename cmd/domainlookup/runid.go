@@ -0,0 +1,17 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// newRunID returns an ID of the run started at start: its UTC time, so IDs
+// sort by time, and random hex telling apart runs started together
+func newRunID(start time.Time) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return start.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// sampler randomly keeps about rate of the domains it sees
+type sampler struct {
+	rate float64
+	rand *rand.Rand
+
+	seen, kept int
+}
+
+// newSampler returns a sampler keeping rate (0, 1] of domains, seeded with
+// seed or the current time when seed is 0. It returns nil when rate is 1,
+// i.e. every domain is kept
+func newSampler(rate float64, seed int64) (*sampler, error) {
+	if rate <= 0 || rate > 1 {
+		return nil, fmt.Errorf("sample rate %v is not in (0, 1]", rate)
+	}
+	if rate == 1 {
+		return nil, nil
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &sampler{rate: rate, rand: rand.New(rand.NewSource(seed))}, nil
+}
+
+// keep reports whether to look up the next domain. It is not safe for
+// concurrent use
+func (s *sampler) keep() bool {
+	s.seen++
+	if s.rand.Float64() < s.rate {
+		s.kept++
+		return true
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// outputSchemaVersion versions the JSON output contract. Bump the minor
+// version when fields are added and the major version when fields change or
+// are removed
+const outputSchemaVersion = "1.18"
+
+// outputSchema returns the JSON schema of a DomainLookupResult. Fields
+// without omitempty are required
+func outputSchema() map[string]interface{} {
+	defs := map[string]interface{}{}
+	schema := typeSchema(reflect.TypeOf(DomainLookupResult{}), defs, map[reflect.Type]bool{})
+	if len(defs) > 0 {
+		schema["$defs"] = defs
+	}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = "https://github.com/aptxx/domainlookup/schema/result/" + outputSchemaVersion
+	schema["title"] = "domainlookup result"
+	schema["version"] = outputSchemaVersion
+	return schema
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// typeSchema returns the JSON schema of values of t as encoding/json
+// marshals them. Struct types containing themselves, expanding marks those
+// being expanded, are referenced as $defs, collected into defs
+func typeSchema(t reflect.Type, defs map[string]interface{}, expanding map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+	if expanding[t] {
+		defs[t.Name()] = nil
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs, expanding)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs, expanding)}
+	case reflect.Struct:
+		expanding[t] = true
+		defer delete(expanding, t)
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = typeSchema(field.Type, defs, expanding)
+			if !strings.Contains(","+options+",", ",omitempty,") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+		if def, ok := defs[t.Name()]; ok && def == nil {
+			defs[t.Name()] = schema
+			return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		}
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// printSchema writes the JSON schema of the output
+func printSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(outputSchema())
+}
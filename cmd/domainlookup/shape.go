@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// -request-shape options
+const (
+	shapeLowercase = "lowercase"
+	shapeUppercase = "uppercase"
+	shapeSlash     = "slash"
+)
+
+// requestShape is how the domain queries of a TLD are written for servers
+// picky about them, lowercase without a trailing slash by default
+type requestShape struct {
+	uppercase bool
+	slash     bool
+}
+
+// requestShapes are the shapes of TLDs set by -request-shape. It isn't
+// changed after parsing so it needs no lock
+type requestShapes map[string]requestShape
+
+// parseRequestShapes parses tld=option[,option] shapes
+func parseRequestShapes(shapes []string) (requestShapes, error) {
+	m := make(requestShapes)
+	for _, value := range shapes {
+		tld, options, ok := strings.Cut(value, "=")
+		tld = lookupTLD(tld)
+		if !ok || tld == "" {
+			return nil, fmt.Errorf("request shape %q is not tld=option", value)
+		}
+		var shape requestShape
+		for _, option := range strings.Split(options, ",") {
+			switch strings.ToLower(strings.TrimSpace(option)) {
+			case shapeLowercase:
+				shape.uppercase = false
+			case shapeUppercase:
+				shape.uppercase = true
+			case shapeSlash:
+				shape.slash = true
+			default:
+				return nil, fmt.Errorf("request shape %q has option %q, want lowercase, uppercase or slash", value, option)
+			}
+		}
+		m[tld] = shape
+	}
+	return m, nil
+}
+
+// name returns domain in the case of the shape
+func (shape requestShape) name(domain string) string {
+	if shape.uppercase {
+		return strings.ToUpper(domain)
+	}
+	return strings.ToLower(domain)
+}
+
+// url returns the object query URL in the shape
+func (shape requestShape) url(query string) string {
+	if shape.slash && !strings.HasSuffix(query, "/") {
+		return query + "/"
+	}
+	return query
+}
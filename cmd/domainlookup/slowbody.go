@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// default window a response body must advance in
+	defaultReadStall = 10 * time.Second
+
+	// bytes a body must advance by per window unless it ends
+	slowBodyBytes = 512
+)
+
+// errSlowResponse is returned for bodies stalling or trickling slower than
+// slowBodyBytes per window
+var errSlowResponse = errors.New("slow response")
+
+// stallGuard reads a response body, cancelling its request when a window
+// passes with fewer than slowBodyBytes read. The total timeout alone lets a
+// server trickling bytes hold a worker until the deadline
+type stallGuard struct {
+	r      io.Reader
+	read   int64
+	cancel func()
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	last    int64
+	stalled bool
+	done    bool
+}
+
+func newStallGuard(r io.Reader, window time.Duration, cancel func()) *stallGuard {
+	guard := &stallGuard{r: r, cancel: cancel}
+	guard.timer = time.AfterFunc(window, func() {
+		guard.mu.Lock()
+		defer guard.mu.Unlock()
+		if guard.done {
+			return
+		}
+		read := atomic.LoadInt64(&guard.read)
+		if read-guard.last < slowBodyBytes {
+			guard.stalled = true
+			guard.cancel()
+			return
+		}
+		guard.last = read
+		guard.timer.Reset(window)
+	})
+	return guard
+}
+
+func (guard *stallGuard) Read(p []byte) (int, error) {
+	n, err := guard.r.Read(p)
+	atomic.AddInt64(&guard.read, int64(n))
+	return n, err
+}
+
+// Stop ends the guard, reporting whether it cancelled the request
+func (guard *stallGuard) Stop() bool {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	guard.done = true
+	guard.timer.Stop()
+	return guard.stalled
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupServerSlowBody(t *testing.T) {
+	const window = 100 * time.Millisecond
+	tests := []struct {
+		name string
+		// the body is sent in chunks of chunk bytes every interval
+		chunk    int
+		chunks   int
+		interval time.Duration
+		want     string
+	}{
+		{"stalled", 0, 1, 2 * time.Second, messageSlowResponse},
+		{"trickling", 16, 100, 20 * time.Millisecond, messageSlowResponse},
+		{"slow but steady", 1024, 6, 50 * time.Millisecond, messageRegistered},
+		{"fast", 64 << 10, 1, 0, messageRegistered},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/rdap+json")
+				w.Write([]byte(`"`))
+				for i := 0; i < tt.chunks; i++ {
+					w.(http.Flusher).Flush()
+					select {
+					case <-r.Context().Done():
+						return
+					case <-time.After(tt.interval):
+					}
+					w.Write([]byte(strings.Repeat("x", tt.chunk)))
+				}
+				w.Write([]byte(`"`))
+			})
+			worker.readStall = window
+			start := time.Now()
+			result := worker.lookupServer(context.Background(), "example.com", "com", server)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+			if tt.want == messageSlowResponse {
+				if elapsed := time.Since(start); elapsed > 4*window {
+					t.Errorf("gave up after %v, want about %v", elapsed, window)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// -sort-by keys
+const (
+	sortByDomain = "domain"
+	sortByTLD    = "tld"
+	sortByStatus = "status"
+	sortByExpiry = "expiry"
+)
+
+// sortWarnThreshold is the number of buffered results past which -sort-by
+// warns about memory use
+const sortWarnThreshold = 1000000
+
+// resultSorter buffers results to emit them sorted by key, equal keys in
+// input order
+type resultSorter struct {
+	key     string
+	results []*DomainLookupResult
+}
+
+func newResultSorter(key string) (*resultSorter, error) {
+	switch key {
+	case sortByDomain, sortByTLD, sortByStatus, sortByExpiry:
+		return &resultSorter{key: key}, nil
+	default:
+		return nil, fmt.Errorf("unknown sort key %q", key)
+	}
+}
+
+func (sorter *resultSorter) Add(result *DomainLookupResult) {
+	sorter.results = append(sorter.results, result)
+	if len(sorter.results) == sortWarnThreshold {
+		warnLog.Printf("WARNING: -sort-by holds more than %d results in memory", sortWarnThreshold)
+	}
+}
+
+// Sorted returns the buffered results sorted
+func (sorter *resultSorter) Sorted() []*DomainLookupResult {
+	results := sorter.results
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if less, ok := sorter.less(a, b); ok {
+			return less
+		}
+		return a.index < b.index
+	})
+	return results
+}
+
+// less orders a and b by the sort key, ok is false when they are equal
+func (sorter *resultSorter) less(a, b *DomainLookupResult) (less bool, ok bool) {
+	switch sorter.key {
+	case sortByDomain:
+		return a.Domain < b.Domain, a.Domain != b.Domain
+	case sortByTLD:
+		return a.TLD < b.TLD, a.TLD != b.TLD
+	case sortByStatus:
+		return a.Message < b.Message, a.Message != b.Message
+	case sortByExpiry:
+		// domains without expiry last
+		x, y := a.expiry(), b.expiry()
+		switch {
+		case x.Equal(y):
+			return false, false
+		case x.IsZero():
+			return false, true
+		case y.IsZero():
+			return true, true
+		default:
+			return x.Before(y), true
+		}
+	}
+	return false, false
+}
+
+// expiry is the expiration event date of the result, zero when unknown
+func (result *DomainLookupResult) expiry() time.Time {
+	return result.eventDate("expiration")
+}
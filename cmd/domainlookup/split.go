@@ -0,0 +1,128 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// maxSplitFiles is the number of -split-output files kept open, the least
+// recently written one is closed to open another
+const maxSplitFiles = 256
+
+// splitFileOther is the file name of results without a TLD, or with one
+// unfit for a file name
+const splitFileOther = "_other"
+
+// splitWriter writes results to a file per TLD in dir, DIR/<tld>.<format>,
+// created on the TLD's first result and appended to when reopened
+type splitWriter struct {
+	dir     string
+	format  string
+	options outputOptions
+
+	files   map[string]*splitFile
+	recent  *list.List
+	created map[string]bool
+}
+
+// splitFile is an open -split-output file and its place in recent
+type splitFile struct {
+	file    *os.File
+	writer  resultWriter
+	element *list.Element
+}
+
+func newSplitWriter(dir, format string, options outputOptions) (*splitWriter, error) {
+	if format == outputGob {
+		// a reopened file would get a second gob stream
+		return nil, errors.New("-o gob can't be written by -split-output")
+	}
+	// validate the format before creating anything
+	if _, err := newResultWriter(nil, format, options); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &splitWriter{
+		dir:     dir,
+		format:  format,
+		options: options,
+		files:   make(map[string]*splitFile),
+		recent:  list.New(),
+		created: make(map[string]bool),
+	}, nil
+}
+
+// splitName returns the file name of the results of tld
+func splitName(tld string) string {
+	if tld == "" {
+		return splitFileOther
+	}
+	for _, c := range tld {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return splitFileOther
+		}
+	}
+	return tld
+}
+
+// open returns the open file of name, truncated on its first open in the run
+func (writer *splitWriter) open(name string) (*splitFile, error) {
+	if f, ok := writer.files[name]; ok {
+		writer.recent.MoveToFront(f.element)
+		return f, nil
+	}
+	if writer.recent.Len() >= maxSplitFiles {
+		oldest := writer.recent.Back().Value.(string)
+		if err := writer.closeFile(oldest); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !writer.created[name] {
+		flags |= os.O_TRUNC
+	}
+	ext := writer.format
+	if ext == outputText {
+		ext = "txt"
+	}
+	file, err := os.OpenFile(filepath.Join(writer.dir, name+"."+ext), flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	writer.created[name] = true
+	resultWriter, _ := newResultWriter(file, writer.format, writer.options)
+	f := &splitFile{file: file, writer: resultWriter, element: writer.recent.PushFront(name)}
+	writer.files[name] = f
+	return f, nil
+}
+
+func (writer *splitWriter) closeFile(name string) error {
+	f := writer.files[name]
+	delete(writer.files, name)
+	writer.recent.Remove(f.element)
+	return f.file.Close()
+}
+
+func (writer *splitWriter) Write(result *DomainLookupResult) error {
+	f, err := writer.open(splitName(result.TLD))
+	if err != nil {
+		return err
+	}
+	return f.writer.Write(result)
+}
+
+// Close closes the open files
+func (writer *splitWriter) Close() error {
+	var first error
+	for name := range writer.files {
+		if err := writer.closeFile(name); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
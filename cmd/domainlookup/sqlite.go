@@ -0,0 +1,124 @@
+//go:build sqlite
+
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteBatch is the number of results written per transaction
+const sqliteBatch = 1000
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS results (
+	domain TEXT PRIMARY KEY,
+	tld TEXT NOT NULL,
+	message TEXT NOT NULL,
+	status TEXT NOT NULL,
+	registrar TEXT NOT NULL,
+	registration TEXT NOT NULL,
+	expiration TEXT NOT NULL,
+	last_changed TEXT NOT NULL,
+	checked_at TEXT NOT NULL
+)`
+
+const sqliteUpsert = `INSERT INTO results
+	(domain, tld, message, status, registrar, registration, expiration, last_changed, checked_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(domain) DO UPDATE SET
+	tld = excluded.tld, message = excluded.message, status = excluded.status,
+	registrar = excluded.registrar, registration = excluded.registration,
+	expiration = excluded.expiration, last_changed = excluded.last_changed,
+	checked_at = excluded.checked_at`
+
+// sqliteStore upserts results into the results table of a SQLite database,
+// keyed by domain
+type sqliteStore struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	pending int
+	now     clock
+}
+
+func openSQLiteStore(path string, now clock) (resultStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db, now: now}, nil
+}
+
+// Write upserts result. Failed lookups leave the stored domain unchanged
+func (store *sqliteStore) Write(result *DomainLookupResult) error {
+	if result.Failed() {
+		return nil
+	}
+	if store.tx == nil {
+		tx, err := store.db.Begin()
+		if err != nil {
+			return err
+		}
+		store.tx = tx
+	}
+
+	var status, registrar string
+	var registration, expiration, lastChanged time.Time
+	if result.Result != nil {
+		status = strings.Join(result.Result.Status, ",")
+		registrar = result.Result.Registrar
+		for _, event := range result.Result.Events {
+			switch event.Action {
+			case "registration":
+				registration = event.Date
+			case "expiration":
+				expiration = event.Date
+			case "last changed":
+				lastChanged = event.Date
+			}
+		}
+	}
+	_, err := store.tx.Exec(sqliteUpsert, result.Domain, result.TLD, result.Message, status, registrar,
+		sqliteTime(registration), sqliteTime(expiration), sqliteTime(lastChanged), sqliteTime(store.now.Now()))
+	if err != nil {
+		return err
+	}
+
+	store.pending++
+	if store.pending >= sqliteBatch {
+		return store.commit()
+	}
+	return nil
+}
+
+func (store *sqliteStore) commit() error {
+	if store.tx == nil {
+		return nil
+	}
+	err := store.tx.Commit()
+	store.tx, store.pending = nil, 0
+	return err
+}
+
+// Close commits the pending results and closes the database
+func (store *sqliteStore) Close() error {
+	err := store.commit()
+	if cerr := store.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sqliteTime formats t as RFC 3339 in UTC, "" for the zero time
+func sqliteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
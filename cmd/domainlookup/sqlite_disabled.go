@@ -0,0 +1,9 @@
+//go:build !sqlite
+
+package main
+
+import "errors"
+
+func openSQLiteStore(path string, now clock) (resultStore, error) {
+	return nil, errors.New("-sqlite needs a build with -tags sqlite")
+}
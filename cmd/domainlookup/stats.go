@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// bootstrapStats describes the composition of the bootstrap lookup map
+type bootstrapStats struct {
+	// TLDs with at least one RDAP server
+	tlds int
+	// TLDs with several RDAP servers
+	multipleServers int
+	// TLDs with a plain http:// server, and with only such servers
+	plaintext, plaintextOnly int
+	// distinct RDAP base URLs
+	servers int
+}
+
+func newBootstrapStats(m map[string][]string) *bootstrapStats {
+	stats := &bootstrapStats{}
+	servers := make(map[string]bool)
+	for _, urls := range m {
+		if len(urls) == 0 {
+			continue
+		}
+		stats.tlds++
+		if len(urls) > 1 {
+			stats.multipleServers++
+		}
+		plaintext := 0
+		for _, u := range urls {
+			servers[strings.TrimRight(u, "/")] = true
+			if strings.HasPrefix(strings.ToLower(u), "http://") {
+				plaintext++
+			}
+		}
+		if plaintext > 0 {
+			stats.plaintext++
+		}
+		if plaintext == len(urls) {
+			stats.plaintextOnly++
+		}
+	}
+	stats.servers = len(servers)
+	return stats
+}
+
+func (stats *bootstrapStats) Print(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `tlds with rdap servers: %d
+tlds with multiple servers: %d
+tlds with plaintext http servers: %d
+tlds with only plaintext http servers: %d
+distinct rdap servers: %d
+`, stats.tlds, stats.multipleServers, stats.plaintext, stats.plaintextOnly, stats.servers)
+	return err
+}
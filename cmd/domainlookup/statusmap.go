@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// categories -map-status can classify a status code as
+var statusCategories = map[string]string{
+	"registered":   messageRegistered,
+	"unregistered": messageUnregistered,
+	"reserved":     messageReserved,
+	"inconclusive": messageInconclusive,
+}
+
+// statusMap overrides the classification of HTTP status codes, by TLD with
+// "" for all TLDs. It isn't changed after parsing so it needs no lock
+type statusMap map[string]map[int]string
+
+// parseStatusMap parses [tld:]code=category mappings
+func parseStatusMap(mappings []string) (statusMap, error) {
+	m := make(statusMap)
+	for _, mapping := range mappings {
+		key, category, ok := strings.Cut(mapping, "=")
+		message, known := statusCategories[strings.ToLower(strings.TrimSpace(category))]
+		tld, code, scoped := strings.Cut(key, ":")
+		if !scoped {
+			tld, code = "", key
+		} else if tld = lookupTLD(tld); tld == "" {
+			ok = false
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(code))
+		if !ok || !known || err != nil || n < 100 || n > 599 {
+			return nil, fmt.Errorf("status mapping %q is not [tld:]code=category with a category of registered, unregistered, reserved or inconclusive", mapping)
+		}
+		if m[tld] == nil {
+			m[tld] = make(map[int]string)
+		}
+		m[tld][n] = message
+	}
+	return m, nil
+}
+
+// message returns the message code maps to for tld, a mapping of the TLD
+// taking precedence over one of all TLDs
+func (m statusMap) message(tld string, code int) (string, bool) {
+	if message, ok := m[tld][code]; ok {
+		return message, true
+	}
+	message, ok := m[""][code]
+	return message, ok
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestParseStatusMap(t *testing.T) {
+	tests := []struct {
+		mapping string
+		wantErr bool
+	}{
+		{"400=unregistered", false},
+		{" de:403 = Inconclusive ", false},
+		{".рф:200=reserved", false},
+		{"400", true},
+		{"400=maybe", true},
+		{"99=registered", true},
+		{"600=registered", true},
+		{"abc=registered", true},
+		{":400=registered", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseStatusMap([]string{tt.mapping}); (err != nil) != tt.wantErr {
+			t.Errorf("parseStatusMap(%q) error = %v, want error %v", tt.mapping, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLookupServerMapStatus(t *testing.T) {
+	m, err := parseStatusMap([]string{"400=unregistered", "de:400=inconclusive", "de:200=reserved", "xn--p1ai:403=registered"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		tld    string
+		status int
+		body   string
+		want   string
+	}{
+		{"all tlds", "com", http.StatusBadRequest, "", messageUnregistered},
+		{"tld wins", "de", http.StatusBadRequest, "", messageInconclusive},
+		{"2xx mapped", "de", http.StatusOK, `{"objectClassName":"domain","status":["active"]}`, messageReserved},
+		{"unicode tld", "xn--p1ai", http.StatusForbidden, "", messageRegistered},
+		{"not mapped", "com", http.StatusForbidden, "", messageForbidden},
+		{"other tld not mapped", "net", http.StatusOK, `{"objectClassName":"domain"}`, messageRegistered},
+		{"error object code", "com", http.StatusOK, `{"errorCode":400,"title":"Bad Request"}`, messageUnregistered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker, server := newTestServer(t, serveRdap(tt.status, "application/rdap+json", tt.body))
+			worker.statusMap = m
+			result := worker.lookupServer(context.Background(), "example."+tt.tld, tt.tld, server)
+			if result.Message != tt.want {
+				t.Errorf("message = %q, want %q", result.Message, tt.want)
+			}
+		})
+	}
+}
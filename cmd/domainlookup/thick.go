@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// registrarLink returns the referral to the registrar's RDAP record of a
+// thin registry response, "" when there is none. Registries point to it with
+// a related link of RDAP type, see RFC 9083 section 4.2 and the ICANN RDAP
+// response profile
+func (domain *rdapDomain) registrarLink() string {
+	for _, link := range domain.Links {
+		if link.Rel != "related" || link.Href == "" {
+			continue
+		}
+		if link.Type != "" && !isRdapContentType(link.Type) {
+			continue
+		}
+		if strings.Contains(link.Href, "/domain/") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// queryThick follows the registrar referral of a thin registry response and
+// merges the registrar's thick record into result. The thin data is kept when
+// there is no referral or it fails
+func (worker *LookupWorker) queryThick(ctx context.Context, thin *rdapDomain, result *RdapLookupResult) {
+	href := thin.registrarLink()
+	if href == "" {
+		return
+	}
+
+	resp, body, err := worker.getRetry(ctx, href)
+	if err != nil {
+		verboseLog.Printf("thick lookup %s: %v", href, err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		verboseLog.Printf("thick lookup %s: %s", href, resp.Status)
+		return
+	}
+	thick, err := parseRdapDomain(body)
+	if err != nil {
+		verboseLog.Printf("thick lookup %s: %v", href, err)
+		return
+	}
+	mergeThick(result, thick)
+}
+
+// mergeThick fills result with the registrar's thick data. The registry
+// stays authoritative for the status, events are combined
+func mergeThick(result, thick *RdapLookupResult) {
+	if len(result.Status) == 0 {
+		result.Status = thick.Status
+	}
+	if thick.Registrar != "" {
+		result.Registrar = thick.Registrar
+	}
+	if result.RegistrarID == "" {
+		result.RegistrarID = thick.RegistrarID
+	}
+	if thick.Reseller != "" {
+		result.Reseller = thick.Reseller
+	}
+	if len(result.Nameservers) == 0 {
+		result.Nameservers = thick.Nameservers
+	}
+	if result.Port43 == "" {
+		result.Port43 = thick.Port43
+	}
+
+	result.Redacted = result.Redacted || thick.Redacted
+	for _, field := range thick.RedactedFields {
+		if !containsString(result.RedactedFields, field) {
+			result.RedactedFields = append(result.RedactedFields, field)
+		}
+	}
+
+	seen := make(map[Event]bool, len(result.Events))
+	for _, event := range result.Events {
+		seen[event] = true
+	}
+	merged := false
+	for _, event := range thick.Events {
+		if !seen[event] {
+			result.Events = append(result.Events, event)
+			merged = true
+		}
+	}
+	if merged {
+		sortEvents(result.Events)
+	}
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
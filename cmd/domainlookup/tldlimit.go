@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// tldLimits caps the concurrent lookups of some TLDs below -c, slots and a
+// queue of waiting lookups per TLD. The map isn't changed after parsing so
+// it needs no lock
+type tldLimits map[string]*tldLimit
+
+// tldLimit are the lookup slots of a TLD and the lookups waiting for one
+type tldLimit struct {
+	mu      sync.Mutex
+	slots   int
+	used    int
+	pending []queuedLookup
+}
+
+// queuedLookup is an input domain and the name it's looked up by
+type queuedLookup struct {
+	input  lookupInput
+	domain string
+}
+
+// parseTLDLimits parses tld=N limits
+func parseTLDLimits(limits []string) (tldLimits, error) {
+	m := make(tldLimits)
+	for _, limit := range limits {
+		tld, value, ok := strings.Cut(limit, "=")
+		tld = lookupTLD(tld)
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || tld == "" || err != nil || n <= 0 {
+			return nil, fmt.Errorf("tld concurrency %q is not tld=N with N > 0", limit)
+		}
+		m[tld] = &tldLimit{slots: n}
+	}
+	return m, nil
+}
+
+// acquire takes a lookup slot of tld for lookup, reporting false when none
+// is free and lookup was queued instead. Slots of TLDs without a limit are
+// free
+func (limits tldLimits) acquire(tld string, lookup queuedLookup) bool {
+	limit, ok := limits[tld]
+	if !ok {
+		return true
+	}
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	if limit.used < limit.slots {
+		limit.used++
+		return true
+	}
+	limit.pending = append(limit.pending, lookup)
+	return false
+}
+
+// release frees a slot of tld, or hands it to the first queued lookup,
+// returned with ok true for the caller to look up
+func (limits tldLimits) release(tld string) (next queuedLookup, ok bool) {
+	limit, limited := limits[tld]
+	if !limited {
+		return next, false
+	}
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	if len(limit.pending) == 0 {
+		limit.used--
+		return next, false
+	}
+	next = limit.pending[0]
+	limit.pending[0] = queuedLookup{}
+	limit.pending = limit.pending[1:]
+	return next, true
+}
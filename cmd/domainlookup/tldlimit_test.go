@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTLDLimitsDontSlowOtherTLDs(t *testing.T) {
+	release := make(chan struct{})
+	var slowInFlight, slowMax int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".slow") {
+			n := atomic.AddInt32(&slowInFlight, 1)
+			defer atomic.AddInt32(&slowInFlight, -1)
+			for prev := atomic.LoadInt32(&slowMax); n > prev; prev = atomic.LoadInt32(&slowMax) {
+				if atomic.CompareAndSwapInt32(&slowMax, prev, n) {
+					break
+				}
+			}
+			<-release
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	limits, err := parseTLDLimits([]string{"slow=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	domains := []string{"a.slow", "b.slow", "c.slow", "d.fast", "e.fast"}
+	unchecked := make(chan lookupInput, len(domains))
+	for _, domain := range domains {
+		unchecked <- lookupInput{domain: domain}
+	}
+	close(unchecked)
+	worker := &LookupWorker{
+		unchecked:     unchecked,
+		client:        srv.Client(),
+		rdapLookupMap: map[string][]string{"slow": {srv.URL}, "fast": {srv.URL}},
+		concurrencies: make(chan struct{}, 2),
+		tldLimits:     limits,
+		Result:        make(chan *DomainLookupResult, len(domains)),
+	}
+	go worker.Start()
+
+	// with the slow server blocked the fast domains still complete
+	fast := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(fast) < 2 {
+		select {
+		case result := <-worker.Result:
+			if result.TLD != "fast" {
+				t.Fatalf("%s done while its server is blocked", result.Domain)
+			}
+			fast[result.Domain] = true
+		case <-timeout:
+			t.Fatalf("only %v of the fast TLD done while the limited one is blocked", fast)
+		}
+	}
+	close(release)
+
+	results := len(fast)
+	for range worker.Result {
+		results++
+	}
+	if results != len(domains) {
+		t.Errorf("got %d results, want %d", results, len(domains))
+	}
+	if got := atomic.LoadInt32(&slowMax); got != 1 {
+		t.Errorf("%d concurrent lookups of the limited TLD, want 1", got)
+	}
+}
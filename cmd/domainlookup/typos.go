@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// -typo-kinds variations
+const (
+	typoOmission   = "omission"
+	typoSwap       = "swap"
+	typoRepetition = "repetition"
+	typoHyphen     = "hyphen"
+	typoTLD        = "tld"
+
+	defaultTypoKinds = typoOmission + "," + typoSwap + "," + typoRepetition + "," + typoHyphen + "," + typoTLD
+)
+
+// typoDomains returns the variations of kinds of seed's label below its TLD,
+// without duplicates and seed itself. tld swaps use the TLDs of tlds and are
+// skipped when it's empty
+func typoDomains(seed, kinds, tlds string) ([]string, error) {
+	seed = strings.ToLower(strings.TrimSpace(seed))
+	dot := strings.LastIndex(seed, ".")
+	if dot <= 0 || dot == len(seed)-1 {
+		return nil, fmt.Errorf("invalid -typos domain %q", seed)
+	}
+	label, tld := seed[:dot], seed[dot+1:]
+
+	var labels []string
+	var domains []string
+	for _, kind := range strings.Split(kinds, ",") {
+		switch kind = strings.TrimSpace(kind); kind {
+		case typoOmission:
+			for i := range label {
+				labels = append(labels, label[:i]+label[i+1:])
+			}
+		case typoSwap:
+			for i := 0; i+1 < len(label); i++ {
+				labels = append(labels, label[:i]+label[i+1:i+2]+label[i:i+1]+label[i+2:])
+			}
+		case typoRepetition:
+			for i := range label {
+				labels = append(labels, label[:i+1]+label[i:])
+			}
+		case typoHyphen:
+			for i := 1; i < len(label); i++ {
+				labels = append(labels, label[:i]+"-"+label[i:])
+			}
+		case typoTLD:
+			if tlds == "" {
+				warnLog.Printf("skip tld typos of %s without -tlds", seed)
+				continue
+			}
+			domains = append(domains, keywordDomains(label, tlds)...)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown typo kind %q", kind)
+		}
+	}
+	for _, variant := range labels {
+		domains = append(domains, variant+"."+tld)
+	}
+
+	seen := map[string]bool{seed: true}
+	unique := domains[:0]
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if seen[domain] || !validDomain(domain) {
+			continue
+		}
+		seen[domain] = true
+		unique = append(unique, domain)
+	}
+	if len(unique) == 0 {
+		return nil, errors.New("-typos generated no domains")
+	}
+	return unique, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// inputReport aggregates how the input would be looked up, for
+// -validate-only
+type inputReport struct {
+	hasServer func(tld string) bool
+	seen      map[string]bool
+
+	lines      int
+	invalid    int
+	duplicates int
+	withServer int
+	// TLD -> domains without a known RDAP server
+	noServer map[string]int
+}
+
+func newInputReport(hasServer func(tld string) bool) *inputReport {
+	return &inputReport{
+		hasServer: hasServer,
+		seen:      make(map[string]bool),
+		noServer:  make(map[string]int),
+	}
+}
+
+// Add normalizes domain like lookups do and counts it
+func (report *inputReport) Add(domain string) {
+	report.lines++
+	domain, _ = cleanInput(domain)
+	name := lookupName(domain)
+	dot := strings.LastIndex(name, ".")
+	if dot <= 0 || dot == len(name)-1 {
+		report.invalid++
+		return
+	}
+	if report.seen[name] {
+		report.duplicates++
+		return
+	}
+	report.seen[name] = true
+
+	tld := name[dot+1:]
+	if report.hasServer(tld) {
+		report.withServer++
+	} else {
+		report.noServer[tld]++
+	}
+}
+
+// maxReportTLDs is the number of TLDs without servers listed
+const maxReportTLDs = 10
+
+func (report *inputReport) Print(w io.Writer) error {
+	noServer := 0
+	tlds := make([]string, 0, len(report.noServer))
+	for tld, n := range report.noServer {
+		noServer += n
+		tlds = append(tlds, tld)
+	}
+	sort.Slice(tlds, func(i, j int) bool {
+		a, b := report.noServer[tlds[i]], report.noServer[tlds[j]]
+		if a != b {
+			return a > b
+		}
+		return tlds[i] < tlds[j]
+	})
+	if len(tlds) > maxReportTLDs {
+		tlds = tlds[:maxReportTLDs]
+	}
+	top := make([]string, len(tlds))
+	for i, tld := range tlds {
+		top[i] = fmt.Sprintf("%s (%d)", tld, report.noServer[tld])
+	}
+
+	_, err := fmt.Fprintf(w, `input lines: %d
+invalid domains: %d
+duplicate domains: %d
+domains with rdap servers: %d
+domains without rdap servers: %d
+top tlds without rdap servers: %s
+`, report.lines, report.invalid, report.duplicates, report.withServer, noServer, strings.Join(top, ", "))
+	return err
+}
+
+// offlineServers reports whether a TLD has servers by the discovery steps
+// not needing the network, dns is skipped
+func offlineServers(rdapMap, overrides map[string][]string, discovery []string) func(tld string) bool {
+	return func(tld string) bool {
+		for _, step := range discovery {
+			switch step {
+			case discoveryBootstrap:
+				if len(rdapMap[tld]) > 0 {
+					return true
+				}
+			case discoveryOverride:
+				if len(overrides[tld]) > 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// offlineOrder is the bootstrap order without the network source
+func offlineOrder(order string) string {
+	var sources []string
+	for _, source := range strings.Split(order, ",") {
+		if strings.TrimSpace(source) != bootstrapNetwork {
+			sources = append(sources, source)
+		}
+	}
+	return strings.Join(sources, ",")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInputReportNormalizes(t *testing.T) {
+	tests := []struct {
+		name           string
+		lines          []string
+		wantInvalid    int
+		wantDuplicates int
+		wantServer     int
+		wantNoServer   map[string]int
+	}{
+		{"case and trailing dot", []string{"Example.COM", "example.com.", " example.com "}, 0, 2, 1, map[string]int{}},
+		{"full-width forms", []string{"ｅｘａｍｐｌｅ．ｃｏｍ", "example.com"}, 0, 1, 1, map[string]int{}},
+		{"unicode tld", []string{"пример.рф", "xn--e1afmkfd.xn--p1ai"}, 0, 1, 0, map[string]int{"xn--p1ai": 1}},
+		// lookups query names IDNA rejects as given, lowercased
+		{"idna rejected", []string{"Bad_Name.com", "bad_name.com"}, 0, 1, 1, map[string]int{}},
+		{"no tld", []string{"localhost", ".com", "example."}, 3, 0, 0, map[string]int{}},
+		{"no server", []string{"a.invalid", "b.invalid", "example.net"}, 0, 0, 1, map[string]int{"invalid": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newInputReport(func(tld string) bool { return tld == "com" || tld == "net" })
+			for _, line := range tt.lines {
+				report.Add(line)
+			}
+			if report.lines != len(tt.lines) || report.invalid != tt.wantInvalid || report.duplicates != tt.wantDuplicates || report.withServer != tt.wantServer {
+				t.Errorf("lines %d, invalid %d, duplicates %d, with server %d, want %d, %d, %d, %d",
+					report.lines, report.invalid, report.duplicates, report.withServer,
+					len(tt.lines), tt.wantInvalid, tt.wantDuplicates, tt.wantServer)
+			}
+			if !reflect.DeepEqual(report.noServer, tt.wantNoServer) {
+				t.Errorf("no server = %v, want %v", report.noServer, tt.wantNoServer)
+			}
+		})
+	}
+}
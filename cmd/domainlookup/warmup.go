@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// concurrent lookups of the warmup
+	warmupConcurrency = 16
+	warmupTimeout     = 10 * time.Second
+)
+
+// dnsCache holds the addresses of RDAP hosts resolved up front
+type dnsCache struct {
+	mu    sync.RWMutex
+	addrs map[string][]net.IPAddr
+}
+
+func (cache *dnsCache) get(host string) []net.IPAddr {
+	if cache == nil {
+		return nil
+	}
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	return cache.addrs[host]
+}
+
+func (cache *dnsCache) set(host string, addrs []net.IPAddr) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.addrs == nil {
+		cache.addrs = make(map[string][]net.IPAddr)
+	}
+	cache.addrs[host] = addrs
+}
+
+// dialContext dials a cached address of the host in turn, falling back to
+// dial when the host isn't cached
+func (cache *dnsCache) dialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return dial(ctx, network, address)
+		}
+		addrs := cache.get(host)
+		if len(addrs) == 0 {
+			return dial(ctx, network, address)
+		}
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = dial(ctx, network, net.JoinHostPort(addr.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// rdapHost returns the host name of an RDAP base URL
+func rdapHost(rdap string) string {
+	if !strings.Contains(rdap, "://") {
+		rdap = "https://" + rdap
+	}
+	u, err := url.Parse(rdap)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// warmup resolves the hosts of the RDAP servers of tlds into cache. Hosts
+// failing to resolve are reported and skipped
+func (worker *LookupWorker) warmup(cache *dnsCache, tlds map[string]int) {
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+
+	hosts := make(map[string]bool)
+	for tld := range tlds {
+		for _, server := range worker.rdapServers(ctx, tld) {
+			if host := rdapHost(server); host != "" && net.ParseIP(host) == nil {
+				hosts[host] = true
+			}
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, warmupConcurrency)
+	for host := range hosts {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(host string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				warnLog.Printf("warmup: skip %s: %v", host, err)
+				return
+			}
+			cache.set(host, addrs)
+			verboseLog.Printf("warmup: %s resolved to %v", host, addrs)
+		}(host)
+	}
+	wg.Wait()
+}
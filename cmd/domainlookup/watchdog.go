@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultStallWarn is how long results may wait on the consumer before the
+// watchdog warns
+const defaultStallWarn = time.Minute
+
+// resultWatch tracks results handed to the Result consumer for the watchdog
+type resultWatch struct {
+	// results blocked sending on Result
+	waiting int64
+
+	// unix nanoseconds of the last result taken by the consumer
+	lastTaken int64
+}
+
+// sendResult sends result on worker.Result, tracking how long the consumer
+// takes
+func (worker *LookupWorker) sendResult(result *DomainLookupResult) {
+	atomic.AddInt64(&worker.watch.waiting, 1)
+	worker.Result <- result
+	atomic.StoreInt64(&worker.watch.lastTaken, worker.now.Now().UnixNano())
+	atomic.AddInt64(&worker.watch.waiting, -1)
+}
+
+// watchdog warns every interval the consumer of Result, like a slow output or
+// webhook, takes no results while some wait, and tells such output stalls
+// apart from waiting on RDAP servers in the verbose log, until stop is closed
+func (worker *LookupWorker) watchdog(interval time.Duration, stop <-chan struct{}) {
+	atomic.StoreInt64(&worker.watch.lastTaken, worker.now.Now().UnixNano())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		idle := worker.now.Since(time.Unix(0, atomic.LoadInt64(&worker.watch.lastTaken)))
+		if idle < interval {
+			continue
+		}
+		if waiting := atomic.LoadInt64(&worker.watch.waiting); waiting > 0 {
+			warnLog.Printf("WARNING: output took no result for %v, %d results waiting on it", idle.Round(time.Second), waiting)
+		} else {
+			verboseLog.Printf("no result for %v, lookups are waiting on RDAP servers", idle.Round(time.Second))
+		}
+	}
+}
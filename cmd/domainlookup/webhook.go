@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookRetries is the number of retries of a failed webhook post
+const webhookRetries = 3
+
+// webhookStore posts results to a webhook as JSON arrays of up to batch
+// results. Posts failing with a network error or a 5xx are retried, others
+// and those failing after retries are dropped with a warning so an
+// unavailable endpoint doesn't stop the run. Nothing is retried or posted
+// once ctx, the run's, is done
+type webhookStore struct {
+	ctx     context.Context
+	client  *http.Client
+	url     string
+	batch   int
+	timeout time.Duration
+	now     clock
+
+	pending []*DomainLookupResult
+}
+
+func newWebhookStore(ctx context.Context, url string, batch int, timeout time.Duration) (resultStore, error) {
+	if batch <= 0 {
+		return nil, fmt.Errorf("invalid webhook batch %d", batch)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook url %q: %w", url, err)
+	}
+	if req.URL.Scheme != "https" && req.URL.Scheme != "http" {
+		return nil, fmt.Errorf("invalid webhook url %q", url)
+	}
+	return &webhookStore{
+		ctx:     ctx,
+		client:  &http.Client{},
+		url:     url,
+		batch:   batch,
+		timeout: timeout,
+	}, nil
+}
+
+func (store *webhookStore) Write(result *DomainLookupResult) error {
+	store.pending = append(store.pending, result)
+	if len(store.pending) >= store.batch {
+		return store.flush()
+	}
+	return nil
+}
+
+// Close posts the remaining results
+func (store *webhookStore) Close() error {
+	return store.flush()
+}
+
+func (store *webhookStore) flush() error {
+	if len(store.pending) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(store.pending)
+	if err != nil {
+		return err
+	}
+	count := len(store.pending)
+	store.pending = store.pending[:0]
+
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = store.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= webhookRetries || store.ctx.Err() != nil {
+			break
+		}
+		verboseLog.Printf("retry webhook post: %v", err)
+		timer := time.NewTimer(retryDelay("", attempt, store.now.Now()))
+		select {
+		case <-store.ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+	warnLog.Printf("drop %d results of webhook: %v", count, err)
+	return nil
+}
+
+// post posts body once, retry reports whether a failure may be temporary
+func (store *webhookStore) post(body []byte) (retry bool, err error) {
+	ctx := store.ctx
+	if store.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, store.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, store.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500, fmt.Errorf("webhook %s: %s", store.url, resp.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses of the posts in turn, the last one repeats
+		statuses     []int
+		cancelled    bool
+		wantRequests int32
+		wantResults  int32
+	}{
+		{"accepted", []int{http.StatusNoContent}, false, 1, 2},
+		{"5xx retried", []int{http.StatusServiceUnavailable, http.StatusOK}, false, 2, 2},
+		{"4xx not retried", []int{http.StatusBadRequest}, false, 1, 0},
+		{"429 not retried", []int{http.StatusTooManyRequests}, false, 1, 0},
+		{"run cancelled", []int{http.StatusInternalServerError}, true, 0, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var received int32
+			var accepted int32
+			_, url, requests, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&received, 1)) - 1
+				if n >= len(tt.statuses) {
+					n = len(tt.statuses) - 1
+				}
+				if status := tt.statuses[n]; status >= 300 {
+					w.WriteHeader(status)
+					return
+				}
+				var results []*DomainLookupResult
+				if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
+					t.Error(err)
+				}
+				atomic.AddInt32(&accepted, int32(len(results)))
+				w.WriteHeader(tt.statuses[n])
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancelled {
+				cancel()
+			} else {
+				defer cancel()
+			}
+			store, err := newWebhookStore(ctx, url, 2, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			for _, result := range testResults(2) {
+				if err := store.Write(result); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := atomic.LoadInt32(requests); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if got := atomic.LoadInt32(&accepted); got != tt.wantResults {
+				t.Errorf("webhook got %d results, want %d", got, tt.wantResults)
+			}
+			if tt.cancelled && time.Since(start) > 100*time.Millisecond {
+				t.Errorf("cancelled run took %v to give up", time.Since(start))
+			}
+		})
+	}
+}
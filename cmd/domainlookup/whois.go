@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WHOIS server of IANA referring to the WHOIS servers of TLDs
+	whoisIANA = "whois.iana.org"
+
+	// max bytes of a WHOIS response
+	whoisMaxBody = 1 << 20
+)
+
+// WHOIS answers of registries without a record of the domain
+var whoisNotFound = []string{
+	"no match",
+	"not found",
+	"no data found",
+	"no entries found",
+	"no object found",
+	"status: free",
+	"status: available",
+	"is available for registration",
+}
+
+// WHOIS keys of the expiration date, the first one present is used
+var whoisExpiryKeys = []string{
+	"registry expiry date",
+	"registrar registration expiration date",
+	"expiration date",
+	"expiry date",
+	"expires",
+	"paid-till",
+}
+
+// layouts of WHOIS dates besides RFC 3339
+var whoisDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02-Jan-2006",
+	"2006.01.02",
+	"2006/01/02",
+}
+
+// whoisComparison is how the WHOIS record of a domain compares to its RDAP
+// result with -compare-whois
+type whoisComparison struct {
+	Server string `json:"server,omitempty"`
+
+	// classification of the WHOIS record or why it couldn't be fetched
+	Message    string     `json:"message"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+
+	// whether the status and expiration date agree, and which don't
+	Match      bool     `json:"match"`
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// whoisClient queries WHOIS servers over TCP port 43, finding the server
+// of a TLD by IANA once per TLD
+type whoisClient struct {
+	dialer net.Dialer
+
+	mu      sync.Mutex
+	servers map[string]string
+}
+
+func newWhoisClient() *whoisClient {
+	return &whoisClient{servers: make(map[string]string)}
+}
+
+// query returns the WHOIS response of server to name
+func (client *whoisClient) query(ctx context.Context, server, name string) (string, error) {
+	conn, err := client.dialer.DialContext(ctx, "tcp", net.JoinHostPort(server, "43"))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := io.WriteString(conn, name+"\r\n"); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, whoisMaxBody))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// server returns the WHOIS server of tld, empty when IANA knows none
+func (client *whoisClient) server(ctx context.Context, tld string) (string, error) {
+	client.mu.Lock()
+	server, ok := client.servers[tld]
+	client.mu.Unlock()
+	if ok {
+		return server, nil
+	}
+
+	text, err := client.query(ctx, whoisIANA, tld)
+	if err != nil {
+		return "", fmt.Errorf("whois server of %s: %w", tld, err)
+	}
+	fields := whoisFields(text)
+	server = fields["whois"]
+	if server == "" {
+		server = fields["refer"]
+	}
+	client.mu.Lock()
+	client.servers[tld] = server
+	client.mu.Unlock()
+	return server, nil
+}
+
+// whoisFields returns the first value of each key: value line, keys in lower
+// case
+func whoisFields(text string) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if _, seen := fields[key]; !seen && value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// parseWhois classifies a WHOIS record and returns its expiration date,
+// zero when it has none
+func parseWhois(text string) (string, time.Time) {
+	lower := strings.ToLower(text)
+	for _, phrase := range whoisNotFound {
+		if strings.Contains(lower, phrase) {
+			return messageUnregistered, time.Time{}
+		}
+	}
+	fields := whoisFields(text)
+	if fields["domain name"] == "" && fields["domain"] == "" {
+		return messageInconclusive, time.Time{}
+	}
+	for _, key := range whoisExpiryKeys {
+		if value, ok := fields[key]; ok {
+			return messageRegistered, parseWhoisDate(value)
+		}
+	}
+	return messageRegistered, time.Time{}
+}
+
+func parseWhoisDate(value string) time.Time {
+	for _, layout := range whoisDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+var errNoWhoisServer = errors.New("no WHOIS server")
+
+// compareWhois looks domain up in WHOIS and compares it to result, on the
+// server of the RDAP port43 reference or else the one IANA names for tld
+func (worker *LookupWorker) compareWhois(ctx context.Context, domain, tld string, result *DomainLookupResult) *whoisComparison {
+	comparison := &whoisComparison{}
+	var server string
+	var err error
+	if result.Result != nil && result.Result.Port43 != "" {
+		server = result.Result.Port43
+	} else {
+		server, err = worker.whois.server(ctx, tld)
+	}
+	if err == nil && server == "" {
+		err = errNoWhoisServer
+	}
+	var text string
+	if err == nil {
+		comparison.Server = server
+		text, err = worker.whois.query(ctx, server, domain)
+	}
+	if err != nil {
+		// the messages of errorMessage point at the RDAP server
+		comparison.Message = err.Error()
+		return comparison
+	}
+
+	message, expiration := parseWhois(text)
+	comparison.Message = message
+	if !expiration.IsZero() {
+		comparison.Expiration = &expiration
+	}
+	if message == messageInconclusive {
+		return comparison
+	}
+
+	// reserved domains are in the registry like registered ones
+	registered := result.Message != messageUnregistered
+	if registered != (message == messageRegistered) {
+		comparison.Mismatches = append(comparison.Mismatches, "status")
+	}
+	if rdap := result.eventDate("expiration"); !rdap.IsZero() && !expiration.IsZero() &&
+		rdap.UTC().Format("2006-01-02") != expiration.UTC().Format("2006-01-02") {
+		comparison.Mismatches = append(comparison.Mismatches, "expiration")
+	}
+	comparison.Match = len(comparison.Mismatches) == 0
+	return comparison
+}
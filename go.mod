@@ -1,3 +1,10 @@
 module github.com/aptxx/domainlookup
 
 go 1.18
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/net v0.35.0
+)
+
+require golang.org/x/text v0.22.0 // indirect